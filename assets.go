@@ -0,0 +1,43 @@
+package liveview
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+// digestFiles returns a digest over the contents of the files at paths, in
+// order
+func digestFiles(paths []string) (string, error) {
+	h := sha256.New()
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", fmt.Errorf("track static %s: %w", path, err)
+		}
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", fmt.Errorf("track static %s: %w", path, err)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
+
+// setStaticDigest sets the digest of the tracked assets the server
+// currently serves
+func (m *Manager) setStaticDigest(digest string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.staticDigest = digest
+}
+
+// staleStatic reports whether a client that loaded assets with digest is
+// running outdated assets. Clients that send no digest are not checked.
+func (m *Manager) staleStatic(digest string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return digest != "" && m.staticDigest != "" && digest != m.staticDigest
+}
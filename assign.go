@@ -0,0 +1,53 @@
+package liveview
+
+// Key is a typed assign key. Declaring keys once, e.g.
+//
+//	var count = liveview.Key[int]("count")
+//
+// lets views read and write assigns without type assertions:
+//
+//	count.Set(ctx, count.Get(ctx)+1)
+type Key[T any] string
+
+// Get returns the value assigned to k, or the zero value of T if it is
+// missing or has another type
+func (k Key[T]) Get(ctx *Context) T {
+	v, _ := k.Lookup(ctx)
+	return v
+}
+
+// GetOr returns the value assigned to k, or def if it is missing or has
+// another type
+func (k Key[T]) GetOr(ctx *Context, def T) T {
+	if v, ok := k.Lookup(ctx); ok {
+		return v
+	}
+	return def
+}
+
+// Lookup returns the value assigned to k and whether it is set with type T
+func (k Key[T]) Lookup(ctx *Context) (T, bool) {
+	v, ok := ctx.Get(string(k))
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	t, ok := v.(T)
+	return t, ok
+}
+
+// Set assigns v to k and marks it changed, like Context.Assign
+func (k Key[T]) Set(ctx *Context, v T) {
+	ctx.Assign(string(k), v)
+}
+
+// Update assigns the result of fn applied to the current value of k
+func (k Key[T]) Update(ctx *Context, fn func(T) T) {
+	k.Set(ctx, fn(k.Get(ctx)))
+}
+
+// GetOr returns the value assigned to key if it has type T, or def
+// otherwise
+func GetOr[T any](ctx *Context, key string, def T) T {
+	return Key[T](key).GetOr(ctx, def)
+}
@@ -0,0 +1,166 @@
+package liveview
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+
+	"github.com/fu2hito/go-liveview/internal/protocol"
+)
+
+// AsyncResult is the value AssignAsync assigns to each of its keys. It
+// starts out loading and becomes either ok with a Result or failed with an
+// Err once the work finishes.
+type AsyncResult struct {
+	Loading bool
+	OK      bool
+	Result  interface{}
+	Err     error
+}
+
+// Failed reports whether loading the value failed
+func (r AsyncResult) Failed() bool {
+	return r.Err != nil
+}
+
+// AssignAsync assigns a loading AsyncResult to each of keys and runs fn in
+// the background. When fn returns, each key is assigned an ok result with
+// its value from the returned map, or a failed result, and the LiveView is
+// re-rendered. A key that already held an ok result keeps it while
+// reloading. fn's context is cancelled when the session ends. During the
+// static render fn is not run and the keys stay loading.
+func (c *Context) AssignAsync(keys []string, fn func(ctx context.Context) (map[string]interface{}, error)) {
+	if c.asyncRefs == nil {
+		c.asyncRefs = make(map[string]uint64)
+	}
+	c.asyncRef++
+	ref := c.asyncRef
+
+	for _, key := range keys {
+		prev, _ := c.Assigns[key].(AsyncResult)
+		c.Assign(key, AsyncResult{Loading: true, OK: prev.OK, Result: prev.Result})
+		c.asyncRefs[key] = ref
+	}
+
+	if c.session == nil {
+		return
+	}
+
+	c.runAsync(func(ctx context.Context) (interface{}, error) {
+		return fn(ctx)
+	}, func(result interface{}, err error) bool {
+		values, _ := result.(map[string]interface{})
+		for _, key := range keys {
+			// A later AssignAsync for the key supersedes this one
+			if c.asyncRefs[key] != ref {
+				continue
+			}
+			delete(c.asyncRefs, key)
+
+			switch v, ok := values[key]; {
+			case err != nil:
+				c.Assign(key, AsyncResult{Err: err})
+			case !ok:
+				c.Assign(key, AsyncResult{Err: fmt.Errorf("assign async: no value returned for %q", key)})
+			default:
+				c.Assign(key, AsyncResult{OK: true, Result: v})
+			}
+		}
+		return true
+	})
+}
+
+// AsyncHandler is implemented by LiveViews that start tasks with
+// Context.StartAsync
+type AsyncHandler interface {
+	// HandleAsync is called on the session loop with the result of the
+	// task started under name, or the error it returned or panicked with
+	HandleAsync(ctx *Context, name string, result interface{}, err error) error
+}
+
+// asyncTask is a running StartAsync task
+type asyncTask struct {
+	cancel context.CancelFunc
+}
+
+// StartAsync runs fn in the background and hands its result to the
+// LiveView's HandleAsync, followed by a re-render. Starting a task under
+// the name of a running one cancels the running one. Tasks are cancelled
+// when the session ends, and are not run during the static render.
+func (c *Context) StartAsync(name string, fn func(ctx context.Context) (interface{}, error)) {
+	if c.session == nil {
+		return
+	}
+	if c.tasks == nil {
+		c.tasks = make(map[string]*asyncTask)
+	}
+	c.CancelAsync(name)
+
+	task := &asyncTask{}
+	c.tasks[name] = task
+	task.cancel = c.runAsync(fn, func(result interface{}, err error) bool {
+		if c.tasks[name] != task {
+			return false
+		}
+		delete(c.tasks, name)
+		return c.session.manager.handleAsync(c.session, name, result, err)
+	})
+}
+
+// CancelAsync cancels the task started under name. HandleAsync is not
+// called for it.
+func (c *Context) CancelAsync(name string) {
+	if task, ok := c.tasks[name]; ok {
+		task.cancel()
+		delete(c.tasks, name)
+	}
+}
+
+// handleAsync runs on the session loop and passes a finished task to the
+// LiveView. It reports whether the LiveView should be re-rendered.
+func (m *Manager) handleAsync(sess *session, name string, result interface{}, err error) bool {
+	handler, ok := sess.lv.(AsyncHandler)
+	if !ok {
+		log.Printf("LiveView for %s does not implement HandleAsync, dropping result of %s", sess.topic, name)
+		return false
+	}
+
+	sess.lastEvent, sess.lastPayload = "async", name
+	if err := handler.HandleAsync(sess.ctx, name, result, err); err != nil {
+		log.Printf("Failed to handle async %s: %v", name, err)
+		m.fail(sess, protocol.ReasonAsyncFailed)
+		return false
+	}
+	return true
+}
+
+// runAsync runs fn in a goroutine with a context that is cancelled when the
+// session ends, then calls done with its result on the session loop and
+// re-renders if done returns true. A panic in fn is turned into an error.
+func (c *Context) runAsync(fn func(ctx context.Context) (interface{}, error), done func(result interface{}, err error) bool) context.CancelFunc {
+	ctx, cancel := context.WithCancel(c)
+	sess := c.session
+
+	go func() {
+		defer cancel()
+
+		result, err := func() (result interface{}, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("async task panicked: %v\n%s", r, debug.Stack())
+				}
+			}()
+			return fn(ctx)
+		}()
+
+		sess.send(func() {
+			sess.lastEvent, sess.lastPayload = "async", nil
+			if done(result, err) {
+				sess.manager.pushDiff(sess)
+			}
+		})
+	}()
+
+	return cancel
+}
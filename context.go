@@ -2,9 +2,11 @@ package liveview
 
 import (
 	"context"
+	"fmt"
 	"net/url"
 
 	"github.com/a-h/templ"
+	"github.com/fu2hito/go-liveview/internal/render"
 )
 
 // LiveView is the interface that all LiveViews must implement
@@ -22,6 +24,13 @@ type LiveView interface {
 	Render(ctx *Context) templ.Component
 }
 
+// InfoHandler is implemented by LiveViews that receive server-side messages
+// sent with Context.Send, Manager.SendTo or Context.Subscribe
+type InfoHandler interface {
+	// HandleInfo handles a message delivered through the session mailbox
+	HandleInfo(ctx *Context, msg interface{}) error
+}
+
 // Context provides access to LiveView context
 type Context struct {
 	context.Context
@@ -30,6 +39,32 @@ type Context struct {
 	Assigns     map[string]interface{}
 	Changed     map[string]bool
 	broadcaster *Broadcaster
+	session     *session
+
+	// connected is set for mounts over the socket, and mounts counts the
+	// earlier successful joins reported by the client
+	connected bool
+	mounts    int
+
+	// signed is the verified session the LiveView was mounted with
+	signed Session
+
+	// asyncRefs records the latest AssignAsync for each key, so results of
+	// superseded calls are dropped
+	asyncRef  uint64
+	asyncRefs map[string]uint64
+
+	// tasks holds the running StartAsync tasks by name
+	tasks map[string]*asyncTask
+
+	// temporary holds the reset values of assigns set with AssignTemporary
+	temporary map[string]interface{}
+
+	// streams holds the streams configured with Stream by name
+	streams map[string]*stream
+
+	// flash holds the flash messages by kind
+	flash map[string]string
 }
 
 // Socket provides socket operations
@@ -77,12 +112,54 @@ func (c *Context) Assign(key string, value interface{}) {
 	c.Changed[key] = true
 }
 
+// AssignTemporary sets key to value for the next render only. Once it has
+// been rendered, key is reset to resetTo, so a list of new items does not
+// have to be kept in memory. Render such a list in an append-only part
+// (<!--$0+:key-->) so the client adds the items to the ones it already has.
+func (c *Context) AssignTemporary(key string, value, resetTo interface{}) {
+	c.Assign(key, value)
+	if c.temporary == nil {
+		c.temporary = make(map[string]interface{})
+	}
+	c.temporary[key] = resetTo
+}
+
+// IsChanged reports whether key was assigned since the last render. Views
+// can use it to skip recomputing derived values. Changes are reset after
+// every render.
+func (c *Context) IsChanged(key string) bool {
+	return c.Changed[key]
+}
+
+// changedAny reports whether any of keys was assigned since the last render
+func (c *Context) changedAny(keys []string) bool {
+	for _, key := range keys {
+		if c.Changed[key] {
+			return true
+		}
+	}
+	return false
+}
+
 // Get retrieves a value from the context
 func (c *Context) Get(key string) (interface{}, bool) {
 	val, ok := c.Assigns[key]
 	return val, ok
 }
 
+// Connected reports whether the LiveView is mounted over a live socket.
+// It is false during the static render of the initial HTTP request, so
+// views can skip subscriptions and timers there.
+func (c *Context) Connected() bool {
+	return c.connected
+}
+
+// Reconnected reports whether the client had already joined this LiveView
+// before, for example after a dropped connection
+func (c *Context) Reconnected() bool {
+	return c.mounts > 0
+}
+
 // SetBroadcaster sets the broadcaster for this context
 func (c *Context) SetBroadcaster(b *Broadcaster) {
 	c.broadcaster = b
@@ -93,6 +170,28 @@ func (c *Context) GetBroadcaster() *Broadcaster {
 	return c.broadcaster
 }
 
+// Send delivers msg to the LiveView's HandleInfo through the session mailbox.
+// It is safe to call from any goroutine and reports false if the session
+// is no longer running.
+func (c *Context) Send(msg interface{}) bool {
+	if c.session == nil {
+		return false
+	}
+	return c.session.manager.sendInfo(c.session, msg)
+}
+
+// Subscribe subscribes the LiveView to a broadcaster topic. Every
+// BroadcastMessage on the topic is delivered to HandleInfo, and the
+// subscription ends with the session.
+func (c *Context) Subscribe(topic string) error {
+	if c.broadcaster == nil {
+		return fmt.Errorf("no broadcaster configured")
+	}
+	return c.broadcaster.SubscribeContext(c, topic, c.ID, func(msg BroadcastMessage) {
+		c.Send(msg)
+	})
+}
+
 // NewContext creates a new LiveView context
 func NewContext(ctx context.Context, socket Socket, id string) *Context {
 	return &Context{
@@ -114,6 +213,10 @@ type Rendered interface {
 type BaseRendered struct {
 	Static  []string      `json:"s"`
 	Dynamic []interface{} `json:"d"`
+
+	// Deps lists the assigns each dynamic part depends on, see
+	// Context.IsChanged
+	Deps [][]string `json:"-"`
 }
 
 func (r *BaseRendered) GetStatic() []string {
@@ -136,3 +239,57 @@ func (c *Context) RenderedValue() Rendered {
 func (c *Context) SetRenderedValue(r Rendered) {
 	c.Assigns["__rendered__"] = r
 }
+
+// rendered returns the current rendered state with its dependencies
+func (c *Context) rendered() *render.Rendered {
+	br, ok := c.RenderedValue().(*BaseRendered)
+	if !ok {
+		return nil
+	}
+	return &render.Rendered{
+		Static:  br.Static,
+		Dynamic: br.Dynamic,
+		Deps:    br.Deps,
+	}
+}
+
+// commitRender stores r as the current rendered state and starts a new
+// change tracking cycle
+func (c *Context) commitRender(r *render.Rendered) {
+	c.SetRenderedValue(&BaseRendered{
+		Static:  r.Static,
+		Dynamic: r.Dynamic,
+		Deps:    r.Deps,
+	})
+	c.endRender()
+}
+
+// commitFullRender stores r like commitRender and returns the rendering to
+// send to the client, which carries the pending stream operations. Append-only
+// parts are sent as appends, so a client rejoining the same LiveView keeps
+// the items it already has.
+func (c *Context) commitFullRender(r *render.Rendered) *render.Rendered {
+	full := *r
+	full.Dynamic = c.withStreams(r, r.Dynamic, true)
+	for i, appendOnly := range r.Append {
+		if appendOnly && i < len(full.Dynamic) {
+			full.Dynamic[i] = &render.Patch{
+				Dynamic: []interface{}{r.Dynamic[i]},
+				Append:  true,
+			}
+		}
+	}
+	c.commitRender(r)
+	return &full
+}
+
+// endRender resets temporary assigns and changes after a render, or after
+// a render was skipped because nothing it depends on changed
+func (c *Context) endRender() {
+	for key, value := range c.temporary {
+		c.Assigns[key] = value
+	}
+	clear(c.temporary)
+	c.resetStreams()
+	clear(c.Changed)
+}
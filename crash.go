@@ -0,0 +1,145 @@
+package liveview
+
+import (
+	"log"
+	"time"
+
+	"github.com/fu2hito/go-liveview/internal/protocol"
+)
+
+// CrashReport describes a panic recovered from a LiveView callback
+type CrashReport struct {
+	// SessionID is the ID of the crashed session, as seen in Context.ID
+	SessionID string
+	// Topic is the channel topic the session was joined on
+	Topic string
+	// Panic is the value passed to panic
+	Panic interface{}
+	// Stack is the goroutine stack at the time of the panic
+	Stack []byte
+	// LastEvent is the last callback the session handled: "mount", "info"
+	// or the name of a client event
+	LastEvent string
+	// LastPayload is the payload of LastEvent
+	LastPayload interface{}
+	// Time is when the crash was recovered
+	Time time.Time
+}
+
+// CrashReporter receives a report for every recovered LiveView crash
+type CrashReporter interface {
+	ReportCrash(report CrashReport)
+}
+
+// CrashReporterFunc adapts a function to the CrashReporter interface
+type CrashReporterFunc func(report CrashReport)
+
+// ReportCrash implements CrashReporter
+func (f CrashReporterFunc) ReportCrash(report CrashReport) {
+	f(report)
+}
+
+// logCrashReporter is the default reporter and writes crashes to the log
+type logCrashReporter struct{}
+
+func (logCrashReporter) ReportCrash(report CrashReport) {
+	log.Printf("LiveView %s crashed handling %q: %v\n%s", report.SessionID, report.LastEvent, report.Panic, report.Stack)
+}
+
+// RestartPolicy limits how often a client may rejoin a channel after it
+// crashed. A join is rejected once MaxRestarts crashes have happened on the
+// same connection and topic within Window.
+type RestartPolicy struct {
+	// MaxRestarts is the number of crashes tolerated per Window. Zero or
+	// less disables the limit.
+	MaxRestarts int
+	// Window is the period over which crashes are counted
+	Window time.Duration
+}
+
+// DefaultRestartPolicy allows three crashes per channel every five seconds
+var DefaultRestartPolicy = RestartPolicy{
+	MaxRestarts: 3,
+	Window:      5 * time.Second,
+}
+
+// SetCrashReporter sets the reporter that receives crash reports
+func (m *Manager) SetCrashReporter(r CrashReporter) {
+	m.crashReporter = r
+}
+
+// SetRestartPolicy sets the policy applied to rejoins after a crash
+func (m *Manager) SetRestartPolicy(p RestartPolicy) {
+	m.restartPolicy = p
+}
+
+// crash runs on the session loop after a callback panicked. It reports the
+// crash, pushes phx_error to the channel and terminates the session.
+func (m *Manager) crash(sess *session, v interface{}, stack []byte) {
+	report := CrashReport{
+		SessionID:   sess.id,
+		Topic:       sess.topic,
+		Panic:       v,
+		Stack:       stack,
+		LastEvent:   sess.lastEvent,
+		LastPayload: sess.lastPayload,
+		Time:        time.Now(),
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Crash reporter panicked: %v", r)
+			}
+		}()
+		m.crashReporter.ReportCrash(report)
+	}()
+
+	m.mu.Lock()
+	key := sess.key()
+	m.crashes[key] = append(m.recentCrashes(key, report.Time), report.Time)
+	m.mu.Unlock()
+
+	m.fail(sess, protocol.ReasonCrashed)
+}
+
+// allowRestart reports whether a join on key is permitted by the restart
+// policy
+func (m *Manager) allowRestart(key channelKey) bool {
+	if m.restartPolicy.MaxRestarts <= 0 {
+		return true
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	recent := m.recentCrashes(key, time.Now())
+	if len(recent) == 0 {
+		delete(m.crashes, key)
+	} else {
+		m.crashes[key] = recent
+	}
+	return len(recent) < m.restartPolicy.MaxRestarts
+}
+
+// recentCrashes returns the crash times for key that fall inside the
+// restart window ending at now. The caller must hold m.mu.
+func (m *Manager) recentCrashes(key channelKey, now time.Time) []time.Time {
+	times := m.crashes[key]
+	cutoff := now.Add(-m.restartPolicy.Window)
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+// forgetCrashes drops the crash history of every channel on conn
+func (m *Manager) forgetCrashes(connID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key := range m.crashes {
+		if key.conn == connID {
+			delete(m.crashes, key)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package liveview
+
+import (
+	"errors"
+
+	"github.com/fu2hito/go-liveview/internal/protocol"
+)
+
+var (
+	// ErrUnauthorized can be returned from Mount, optionally wrapped, to
+	// reject a join with the "unauthorized" reason
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrNotFound can be returned from Mount, optionally wrapped, to reject
+	// a join with the "not_found" reason
+	ErrNotFound = errors.New("not found")
+)
+
+// joinErrorReason maps a Mount error to the reason sent in the join reply
+func joinErrorReason(err error) string {
+	switch {
+	case errors.Is(err, ErrUnauthorized):
+		return protocol.ReasonUnauthorized
+	case errors.Is(err, ErrNotFound):
+		return protocol.ReasonNotFound
+	default:
+		return protocol.ReasonMountFailed
+	}
+}
@@ -2,6 +2,7 @@ package chat
 
 import (
 	"context"
+	"html"
 	"io"
 	"net/url"
 	"time"
@@ -18,41 +19,34 @@ type Message struct {
 	Timestamp time.Time
 }
 
-// Chat is a real-time chat LiveView
+// Chat is a real-time chat LiveView. Messages are temporary assigns, so
+// only the ones not yet rendered are kept.
 type Chat struct {
-	messages []Message
 	username string
 }
 
 // New creates a new Chat LiveView
 func New() liveview.LiveView {
-	return &Chat{
-		messages: make([]Message, 0),
-	}
+	return &Chat{}
 }
 
 // Mount is called when the LiveView first mounts
 func (c *Chat) Mount(ctx *liveview.Context, params url.Values) error {
-	c.messages = make([]Message, 0)
 	c.username = params.Get("username")
 	if c.username == "" {
 		c.username = "Anonymous"
 	}
 
-	ctx.Assign("messages", c.messages)
+	ctx.AssignTemporary("messages", []Message(nil), []Message(nil))
 	ctx.Assign("username", c.username)
 	ctx.Assign("message", "")
 
-	// Subscribe to broadcast messages
-	if broadcaster := ctx.GetBroadcaster(); broadcaster != nil {
-		broadcaster.SubscribeContext(ctx, "chat:room", ctx.ID, func(msg liveview.BroadcastMessage) {
-			if newMsg, ok := msg.Payload.(Message); ok {
-				c.messages = append(c.messages, newMsg)
-				ctx.Assign("messages", c.messages)
-				// Trigger re-render
-				ctx.Socket.PushEvent("phx:update", map[string]interface{}{})
-			}
-		})
+	// Subscribe to broadcast messages once connected; they arrive in
+	// HandleInfo
+	if ctx.Connected() && ctx.GetBroadcaster() != nil {
+		if err := ctx.Subscribe("chat:room"); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -75,8 +69,7 @@ func (c *Chat) HandleEvent(ctx *liveview.Context, event string, payload map[stri
 				broadcaster.Broadcast("chat:room", "new_message", msg)
 			} else {
 				// Fallback: only update current client
-				c.messages = append(c.messages, msg)
-				ctx.Assign("messages", c.messages)
+				addMessage(ctx, msg)
 			}
 
 			ctx.Assign("message", "")
@@ -90,6 +83,23 @@ func (c *Chat) HandleEvent(ctx *liveview.Context, event string, payload map[stri
 	return nil
 }
 
+// HandleInfo handles messages broadcast to the chat room
+func (c *Chat) HandleInfo(ctx *liveview.Context, msg interface{}) error {
+	if broadcastMsg, ok := msg.(liveview.BroadcastMessage); ok {
+		if newMsg, ok := broadcastMsg.Payload.(Message); ok {
+			addMessage(ctx, newMsg)
+		}
+	}
+	return nil
+}
+
+// addMessage queues msg for the next render, together with any other
+// messages that arrived since the last one
+func addMessage(ctx *liveview.Context, msg Message) {
+	messages := liveview.GetOr(ctx, "messages", []Message(nil))
+	ctx.AssignTemporary("messages", append(messages, msg), []Message(nil))
+}
+
 // HandleParams handles URL parameter changes
 func (c *Chat) HandleParams(ctx *liveview.Context, params url.Values) error {
 	return nil
@@ -97,42 +107,39 @@ func (c *Chat) HandleParams(ctx *liveview.Context, params url.Values) error {
 
 // Render returns the component to render
 func (c *Chat) Render(ctx *liveview.Context) templ.Component {
-	messages, _ := ctx.Get("messages")
-	username, _ := ctx.Get("username")
-	return chatTemplate(messages.([]Message), username.(string))
+	messages := liveview.GetOr(ctx, "messages", []Message(nil))
+	username := liveview.GetOr(ctx, "username", "Anonymous")
+	return chatTemplate(messages, username)
 }
 
 func chatTemplate(messages []Message, username string) templ.Component {
-	html := `<div class="chat-container">
+	// The messages part is append-only: each render sends just the new
+	// messages and the client adds them to the list
+	page := `<div class="chat-container">
 		<h1>Chat Room</h1>
 		<div class="username">
-			<input type="text" name="username" value="` + username + `" phx-change="set_username" />
-		</div>
-		<div class="messages">
-			` + renderMessages(messages) + `
+			<span>Name: <!--$0:username-->` + html.EscapeString(username) + `<!--/$0--></span>
+			<input type="text" name="username" placeholder="Change name" phx-change="set_username" />
 		</div>
+		<div class="messages"><!--$1+:messages-->` + renderMessages(messages) + `<!--/$1--></div>
 		<form phx-submit="send_message">
 			<input type="text" name="message" placeholder="Type a message..." />
 			<button type="submit">Send</button>
 		</form>
 	</div>`
-	return &simpleComponent{html: html}
+	return &simpleComponent{html: page}
 }
 
 func renderMessages(messages []Message) string {
-	if len(messages) == 0 {
-		return `<p class="empty">No messages yet. Be the first to say something!</p>`
-	}
-
-	html := ""
+	out := ""
 	for _, msg := range messages {
-		html += `<div class="message">
-			<span class="user">` + msg.User + `:</span>
-			<span class="text">` + msg.Text + `</span>
+		out += `<div class="message">
+			<span class="user">` + html.EscapeString(msg.User) + `:</span>
+			<span class="text">` + html.EscapeString(msg.Text) + `</span>
 			<span class="time">` + msg.Timestamp.Format("15:04") + `</span>
 		</div>`
 	}
-	return html
+	return out
 }
 
 func generateID() string {
@@ -10,6 +10,9 @@ import (
 	"github.com/fu2hito/go-liveview"
 )
 
+// countKey is the assign holding the current count
+var countKey = liveview.Key[int]("count")
+
 // Counter is a simple counter LiveView
 type Counter struct {
 	count int
@@ -23,7 +26,7 @@ func New() liveview.LiveView {
 // Mount is called when the LiveView first mounts
 func (c *Counter) Mount(ctx *liveview.Context, params url.Values) error {
 	c.count = 0
-	ctx.Assign("count", c.count)
+	countKey.Set(ctx, c.count)
 	return nil
 }
 
@@ -41,7 +44,7 @@ func (c *Counter) HandleEvent(ctx *liveview.Context, event string, payload map[s
 			}
 		}
 	}
-	ctx.Assign("count", c.count)
+	countKey.Set(ctx, c.count)
 	return nil
 }
 
@@ -52,8 +55,7 @@ func (c *Counter) HandleParams(ctx *liveview.Context, params url.Values) error {
 
 // Render returns the component to render
 func (c *Counter) Render(ctx *liveview.Context) templ.Component {
-	count, _ := ctx.Get("count")
-	return counterTemplate(count.(int))
+	return counterTemplate(countKey.Get(ctx))
 }
 
 // counterTemplate renders the counter HTML
@@ -66,10 +66,10 @@ func (f *Form) HandleParams(ctx *liveview.Context, params url.Values) error {
 
 // Render returns the component to render
 func (f *Form) Render(ctx *liveview.Context) templ.Component {
-	user, _ := ctx.Get("user")
-	errors, _ := ctx.Get("errors")
-	submitted, _ := ctx.Get("submitted")
-	return formTemplate(user.(User), errors.(map[string]string), submitted.(bool))
+	user := liveview.Key[User]("user").Get(ctx)
+	errors := liveview.Key[map[string]string]("errors").Get(ctx)
+	submitted := liveview.Key[bool]("submitted").Get(ctx)
+	return formTemplate(user, errors, submitted)
 }
 
 func (f *Form) validate(payload map[string]interface{}) bool {
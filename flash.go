@@ -0,0 +1,160 @@
+package liveview
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/fu2hito/go-liveview/internal/protocol"
+)
+
+// flashCookie is the cookie the client stores the signed flash in when a
+// LiveView redirects it to a regular HTTP page
+const flashCookie = "_lv_flash"
+
+// clearFlashEvent is the client event that clears the flash of the kind
+// sent as its value, or all flashes when the value is empty
+const clearFlashEvent = "lv:clear-flash"
+
+// Flash returns the flash message of kind, such as "info" or "error", set
+// with Socket.PutFlash or carried over from the page the client came from.
+// Templates that declare dependencies can depend on "flash".
+func (c *Context) Flash(kind string) string {
+	return c.flash[kind]
+}
+
+// putFlash sets the flash message of kind
+func (c *Context) putFlash(kind, message string) {
+	if c.flash == nil {
+		c.flash = make(map[string]string)
+	}
+	c.flash[kind] = message
+	c.Changed["flash"] = true
+}
+
+// clearFlash removes the flash message of kind, or all of them when kind
+// is empty
+func (c *Context) clearFlash(kind string) {
+	if kind == "" {
+		clear(c.flash)
+	} else {
+		delete(c.flash, kind)
+	}
+	c.Changed["flash"] = true
+}
+
+// Redirect sends the client to rawURL with a full page load, for pages
+// that are not LiveViews. The flash is carried over in a signed cookie,
+// which the page reads with Handler.Flash. The current LiveView is
+// terminated once the current callback returns.
+func (c *Context) Redirect(rawURL string) error {
+	if c.session == nil {
+		return fmt.Errorf("redirect: context is not connected")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("redirect: %w", err)
+	}
+
+	sess := c.session
+	sess.send(func() { sess.manager.redirectPage(sess, u) })
+	return nil
+}
+
+// redirectPage runs on the session loop and handles Context.Redirect
+func (m *Manager) redirectPage(sess *session, u *url.URL) {
+	token, err := m.signFlash(sess.ctx.flash)
+	if err != nil {
+		log.Printf("Failed to sign flash: %v", err)
+	}
+
+	redirectMsg, err := protocol.NewRedirectMessage(sess.topic, protocol.RedirectPayload{
+		URL:   u.String(),
+		Kind:  "redirect",
+		Flash: token,
+	})
+	if err != nil {
+		log.Printf("Failed to create redirect message: %v", err)
+		return
+	}
+	sess.push(redirectMsg)
+	m.terminate(sess, TerminateLeave)
+}
+
+// signFlash returns a token carrying flash, or an empty string when there
+// is no flash. The token is not a valid session token.
+func (m *Manager) signFlash(flash map[string]string) (string, error) {
+	if len(flash) == 0 {
+		return "", nil
+	}
+
+	m.mu.RLock()
+	signer := m.signer
+	m.mu.RUnlock()
+
+	if signer == nil {
+		return "", fmt.Errorf("no session secret configured")
+	}
+	token, err := signer.Create("", map[string]interface{}{"flash": flash})
+	if err != nil {
+		return "", err
+	}
+	return signer.Encode(token)
+}
+
+// verifyFlash returns the flash carried by a token from signFlash
+func (m *Manager) verifyFlash(token string) (map[string]string, error) {
+	m.mu.RLock()
+	signer := m.signer
+	m.mu.RUnlock()
+
+	if signer == nil {
+		return nil, fmt.Errorf("no session secret configured")
+	}
+	s, err := signer.Validate(token)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := s.Data["view"]; ok {
+		return nil, fmt.Errorf("token is a session token")
+	}
+	return decodeFlash(s.Data["flash"]), nil
+}
+
+// decodeFlash converts a flash decoded from a token back to its map
+func decodeFlash(v interface{}) map[string]string {
+	m, _ := v.(map[string]interface{})
+	if len(m) == 0 {
+		return nil
+	}
+	flash := make(map[string]string, len(m))
+	for kind, message := range m {
+		if s, ok := message.(string); ok {
+			flash[kind] = s
+		}
+	}
+	return flash
+}
+
+// Flash returns the flash a LiveView redirected to this request with
+// Context.Redirect, and clears it so it is shown only once. It is nil when
+// there is none.
+func (h *Handler) Flash(w http.ResponseWriter, r *http.Request) map[string]string {
+	cookie, err := r.Cookie(flashCookie)
+	if err != nil {
+		return nil
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:   flashCookie,
+		Path:   "/",
+		MaxAge: -1,
+	})
+
+	flash, err := h.manager.verifyFlash(cookie.Value)
+	if err != nil {
+		log.Printf("Dropping invalid flash cookie: %v", err)
+		return nil
+	}
+	return flash
+}
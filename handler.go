@@ -1,6 +1,12 @@
 package liveview
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"log"
 	"net/http"
 	"strings"
 
@@ -11,35 +17,182 @@ import (
 type Handler struct {
 	manager  *Manager
 	server   *socket.Server
-	template string
+	session  func(r *http.Request) (Session, error)
+	static   string
+	template *template.Template
+	err      error
 }
 
 // HandlerOptions configures the handler
 type HandlerOptions struct {
-	// Template is the HTML template for the initial page load
+	// Template is the HTML template for the initial page load. It is parsed
+	// with html/template and executed with a PageData, so a literal "{{"
+	// must be written as {{"{{"}}. If it does not parse, every page
+	// responds with 500 Internal Server Error.
 	Template string
+
+	// Secret signs the session tokens embedded in pages. Once a secret is
+	// set, clients must join with such a token. If empty and Session is
+	// set, a random secret is generated and tokens only stay valid for the
+	// lifetime of the process. With neither, pages carry no token.
+	Secret string
+
+	// Session returns the server-side session for a request, typically
+	// the authenticated user. It is signed into the page and handed to
+	// Mount both during the initial render and after the client joins.
+	// Returning ErrUnauthorized responds with 403 Forbidden.
+	Session func(r *http.Request) (Session, error)
+
+	// TrackStatic lists asset files, such as the JS and CSS bundles, whose
+	// digest is embedded in pages. Clients joining with a digest that no
+	// longer matches are told to reload, so they pick up new assets after
+	// a deploy.
+	TrackStatic []string
+}
+
+// PageData is the data the page template is executed with
+type PageData struct {
+	// Topic is the channel topic the client joins for this page. It is
+	// empty when the page is not served through a Router.
+	Topic string
+
+	// Content is the LiveView rendered during the initial request, to be
+	// placed inside the live view container
+	Content template.HTML
+
+	// Session is the signed session token the client sends on join
+	Session string
+
+	// Static is the digest of the tracked assets, sent back on join
+	Static string
 }
 
 // NewHandler creates a new LiveView HTTP handler
 func NewHandler(manager *Manager, server *socket.Server, opts HandlerOptions) *Handler {
-	return &Handler{
+	if opts.Secret != "" {
+		manager.setSessionSecret(opts.Secret)
+	} else if opts.Session != nil && !manager.hasSessionSecret() {
+		manager.setSessionSecret(randomSecret())
+	}
+
+	tmpl, err := template.New("page").Parse(opts.Template)
+	h := &Handler{
 		manager:  manager,
 		server:   server,
-		template: opts.Template,
+		session:  opts.Session,
+		template: tmpl,
+		err:      err,
 	}
+
+	if len(opts.TrackStatic) > 0 {
+		digest, err := digestFiles(opts.TrackStatic)
+		if err != nil {
+			h.err = errors.Join(h.err, err)
+		}
+		h.static = digest
+		manager.setStaticDigest(digest)
+	}
+	return h
 }
 
 // ServeHTTP implements http.Handler
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Check if this is a WebSocket upgrade request
-	if strings.ToLower(r.Header.Get("Upgrade")) == "websocket" {
+	if isWebSocketUpgrade(r) {
 		h.server.ServeHTTP(w, r)
 		return
 	}
 
 	// Serve the initial HTML page
+	h.servePage(w, r, PageData{Static: h.static})
+}
+
+// serveLive renders the LiveView registered for topic in disconnected mode
+// and serves the page with the result and a session token embedded, so the
+// content is visible before the WebSocket joins
+func (h *Handler) serveLive(w http.ResponseWriter, r *http.Request, topic string) {
+	var s Session
+	if h.session != nil {
+		var err error
+		if s, err = h.session(r); err != nil {
+			h.renderError(w, r, topic, err)
+			return
+		}
+	}
+	s.flash = h.Flash(w, r)
+
+	content, err := h.manager.staticRender(r.Context(), topic, r.URL, s)
+	if err != nil {
+		h.renderError(w, r, topic, err)
+		return
+	}
+
+	token, err := h.pageToken(topic, s)
+	if err != nil {
+		log.Printf("Failed to create session token: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	h.servePage(w, r, PageData{
+		Topic:   topic,
+		Content: template.HTML(content),
+		Session: token,
+		Static:  h.static,
+	})
+}
+
+// pageToken returns the session token for a page, or an empty token when
+// no session secret is configured
+func (h *Handler) pageToken(topic string, s Session) (string, error) {
+	if !h.manager.hasSessionSecret() {
+		return "", nil
+	}
+	return h.manager.signSession(topic, s)
+}
+
+// renderError responds to a LiveView that failed to render for a request
+func (h *Handler) renderError(w http.ResponseWriter, r *http.Request, topic string, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.NotFound(w, r)
+	case errors.Is(err, ErrUnauthorized):
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	default:
+		log.Printf("Failed to render LiveView %s: %v", topic, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// servePage renders the page template with data
+func (h *Handler) servePage(w http.ResponseWriter, r *http.Request, data PageData) {
+	if h.err != nil {
+		log.Printf("Handler is misconfigured: %v", h.err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := h.template.Execute(&buf, data); err != nil {
+		log.Printf("Failed to render page template: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.Write([]byte(h.template))
+	w.Write(buf.Bytes())
+}
+
+func randomSecret() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic("liveview: failed to generate secret: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.ToLower(r.Header.Get("Upgrade")) == "websocket"
 }
 
 // DefaultTemplate returns a default HTML template with LiveView client
@@ -53,7 +206,7 @@ func DefaultTemplate(title, csrfToken string) string {
     <meta name="csrf-token" content="` + csrfToken + `">
 </head>
 <body>
-    <div id="live-view-root"></div>
+    <div id="live-view-root" data-phx-topic="{{.Topic}}" data-phx-session="{{.Session}}" data-phx-static="{{.Static}}">{{.Content}}</div>
     <script src="/liveview.js"></script>
     <script>
         document.addEventListener('DOMContentLoaded', function() {
@@ -61,6 +214,7 @@ func DefaultTemplate(title, csrfToken string) string {
                 params: { _csrf_token: document.querySelector('meta[name="csrf-token"]').content }
             });
             liveSocket.connect();
+            liveSocket.mount('live-view-root');
         });
     </script>
 </body>
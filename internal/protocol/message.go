@@ -14,6 +14,26 @@ const (
 	MessageTypeClose     MessageType = "phx_close"
 	MessageTypeError     MessageType = "phx_error"
 	MessageTypeLeave     MessageType = "phx_leave"
+	MessageTypePatch     MessageType = "live_patch"
+	MessageTypeRedirect  MessageType = "live_redirect"
+)
+
+// Error reasons carried in error replies and phx_error pushes
+const (
+	ReasonUnauthorized    = "unauthorized"
+	ReasonNotFound        = "not_found"
+	ReasonBadRequest      = "bad_request"
+	ReasonMountFailed     = "mount_failed"
+	ReasonStale           = "stale"
+	ReasonEventFailed     = "event_failed"
+	ReasonInfoFailed      = "info_failed"
+	ReasonParamsFailed    = "params_failed"
+	ReasonCrashed         = "crashed"
+	ReasonTooManyRestarts = "too_many_restarts"
+	ReasonInvalidSession  = "invalid_session"
+	ReasonShutdown        = "shutdown"
+	ReasonStaleStatic     = "stale_static"
+	ReasonAsyncFailed     = "async_failed"
 )
 
 // Message represents a LiveView protocol message
@@ -71,6 +91,14 @@ type JoinPayload struct {
 	Params  map[string]interface{} `json:"params"`
 	Session string                 `json:"session"`
 	Static  string                 `json:"static"`
+	URL     string                 `json:"url,omitempty"`
+}
+
+// PatchPayload carries a URL change, sent by the client when it patches the
+// URL and by the server to ask the client to update its history
+type PatchPayload struct {
+	URL  string `json:"url"`
+	Kind string `json:"kind,omitempty"`
 }
 
 // NewJoinReply creates a successful join reply message
@@ -90,6 +118,60 @@ func NewJoinReply(topic string, ref string, rendered interface{}) *Message {
 	}
 }
 
+// RedirectPayload carries a navigation to another LiveView. The client sends
+// it with only URL set; the server answers with the topic to join and a
+// session token for it.
+type RedirectPayload struct {
+	URL     string `json:"url"`
+	Topic   string `json:"topic,omitempty"`
+	Kind    string `json:"kind,omitempty"`
+	Session string `json:"session,omitempty"`
+	Flash   string `json:"flash,omitempty"`
+}
+
+// NewReply creates a successful reply message with the given response
+func NewReply(topic string, ref string, response interface{}) *Message {
+	resp, _ := json.Marshal(response)
+	payload, _ := json.Marshal(ReplyPayload{
+		Status:   "ok",
+		Response: resp,
+	})
+	return &Message{
+		Ref:     &ref,
+		Topic:   topic,
+		Event:   string(MessageTypeReply),
+		Payload: payload,
+	}
+}
+
+// NewPatchMessage creates a live_patch push asking the client to change
+// its URL
+func NewPatchMessage(topic string, patch PatchPayload) (*Message, error) {
+	payload, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{
+		Topic:   topic,
+		Event:   string(MessageTypePatch),
+		Payload: payload,
+	}, nil
+}
+
+// NewRedirectMessage creates a live_redirect push asking the client to
+// navigate to another LiveView over the same connection
+func NewRedirectMessage(topic string, redirect RedirectPayload) (*Message, error) {
+	payload, err := json.Marshal(redirect)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{
+		Topic:   topic,
+		Event:   string(MessageTypeRedirect),
+		Payload: payload,
+	}, nil
+}
+
 // NewDiffMessage creates a diff update message
 func NewDiffMessage(topic string, diff DiffPayload) (*Message, error) {
 	payload, err := json.Marshal(diff)
@@ -102,3 +184,34 @@ func NewDiffMessage(topic string, diff DiffPayload) (*Message, error) {
 		Payload: payload,
 	}, nil
 }
+
+// NewErrorReply creates an error reply message for the request with ref
+func NewErrorReply(topic string, ref string, reason string) *Message {
+	response, _ := json.Marshal(map[string]interface{}{
+		"reason": reason,
+	})
+	payload, _ := json.Marshal(ReplyPayload{
+		Status:   "error",
+		Response: response,
+	})
+	return &Message{
+		Ref:     &ref,
+		Topic:   topic,
+		Event:   string(MessageTypeReply),
+		Payload: payload,
+	}
+}
+
+// NewErrorMessage creates a phx_error push telling the client the channel
+// failed and must be rejoined
+func NewErrorMessage(topic string, reason string) *Message {
+	payload, _ := json.Marshal(ErrorPayload{
+		Status: "error",
+		Reason: reason,
+	})
+	return &Message{
+		Topic:   topic,
+		Event:   string(MessageTypeError),
+		Payload: payload,
+	}
+}
@@ -5,6 +5,33 @@ type Rendered struct {
 	Static      []string      `json:"s"`
 	Dynamic     []interface{} `json:"d"`
 	Fingerprint string        `json:"fingerprint,omitempty"`
+
+	// Deps lists, for each dynamic part, the assigns it depends on as
+	// declared in its marker. A nil entry means the part declared none and
+	// is always compared.
+	Deps [][]string `json:"-"`
+
+	// Append marks the dynamic parts whose content is added to what the
+	// client already has instead of replacing it. Such a part renders only
+	// its new items, and an empty part means nothing was added.
+	Append []bool `json:"-"`
+
+	// Stream names, for each dynamic part, the stream it renders, or is
+	// empty. Such a part renders only the pending inserts of the stream.
+	Stream []string `json:"-"`
+}
+
+// Tracked reports whether every dynamic part declares its dependencies
+func (r *Rendered) Tracked() bool {
+	if len(r.Dynamic) == 0 || len(r.Deps) != len(r.Dynamic) {
+		return false
+	}
+	for _, deps := range r.Deps {
+		if deps == nil {
+			return false
+		}
+	}
+	return true
 }
 
 // IsEqual checks if two Rendered structs are equal
@@ -60,6 +87,30 @@ type Patch struct {
 	Dynamic []interface{} `json:"d"`
 	Append  bool          `json:"a,omitempty"`
 	Prepend bool          `json:"p,omitempty"`
+	Stream  *StreamOps    `json:"stream,omitempty"`
+}
+
+// StreamOps are the operations on a stream since the last render. The
+// rendered inserts are sent as the Dynamic of the enclosing Patch, one
+// element with a DOM id per insert.
+type StreamOps struct {
+	Name    string         `json:"name"`
+	Inserts []StreamInsert `json:"inserts,omitempty"`
+	Deletes []string       `json:"deletes,omitempty"`
+	Reset   bool           `json:"reset,omitempty"`
+}
+
+// StreamInsert places the element with DOM id ID at index At of the
+// stream, or at its end when At is negative. An element that is already
+// in the stream is updated in place.
+type StreamInsert struct {
+	ID string `json:"id"`
+	At int    `json:"at"`
+}
+
+// Empty reports whether there are no operations
+func (o *StreamOps) Empty() bool {
+	return len(o.Inserts) == 0 && len(o.Deletes) == 0 && !o.Reset
 }
 
 // Diff calculates the difference between two Rendered states
@@ -74,11 +125,30 @@ func Diff(prev, curr *Rendered) *Patch {
 
 	// Static parts are equal, calculate dynamic diff
 	diff := diffDynamic(prev.Dynamic, curr.Dynamic)
+	for i, appendOnly := range curr.Append {
+		if appendOnly && i < len(diff) {
+			diff[i] = appendPatch(curr.Dynamic[i])
+		}
+	}
 	return &Patch{
 		Dynamic: diff,
 	}
 }
 
+// appendPatch returns the diff entry for the content of an append-only
+// part, or nil when nothing was added. The content is sent even if it
+// equals the previous render, since that only means the same items were
+// added again.
+func appendPatch(content interface{}) interface{} {
+	if content == nil || content == "" {
+		return nil
+	}
+	return &Patch{
+		Dynamic: []interface{}{content},
+		Append:  true,
+	}
+}
+
 func staticEqual(a, b []string) bool {
 	if len(a) != len(b) {
 		return false
@@ -36,3 +36,51 @@ func TestDiffSimple(t *testing.T) {
 		t.Errorf("BuildHTML: got %q, want %q", result, expected)
 	}
 }
+
+func TestParseDeps(t *testing.T) {
+	r := render.ParseTemplOutput(`<p><!--$0:count, name-->1<!--/$0--><!--$1-->x<!--/$1--></p>`)
+
+	if len(r.Dynamic) != 2 || r.Dynamic[0] != "1" || r.Dynamic[1] != "x" {
+		t.Fatalf("Dynamic: got %v", r.Dynamic)
+	}
+	if len(r.Deps[0]) != 2 || r.Deps[0][0] != "count" || r.Deps[0][1] != "name" {
+		t.Errorf("Deps[0]: got %v, want [count name]", r.Deps[0])
+	}
+	if r.Deps[1] != nil {
+		t.Errorf("Deps[1]: got %v, want nil", r.Deps[1])
+	}
+	if r.Tracked() {
+		t.Error("Tracked: got true for a part without declared deps")
+	}
+}
+
+func TestAppendOnlyDiff(t *testing.T) {
+	prev := render.ParseTemplOutput("<ul><!--$0+:items--><li>a</li><!--/$0--></ul>")
+	if len(prev.Append) != 1 || !prev.Append[0] {
+		t.Fatalf("Append: got %v, want [true]", prev.Append)
+	}
+
+	// The same items added again are still sent
+	curr := render.ParseTemplOutput("<ul><!--$0+:items--><li>a</li>\n<!--/$0--></ul>")
+	diff := render.Diff(prev, curr)
+	patch, ok := diff.Dynamic[0].(*render.Patch)
+	if !ok || !patch.Append || patch.Dynamic[0] != "<li>a</li>\n" {
+		t.Fatalf("Dynamic[0]: got %#v, want an append patch", diff.Dynamic[0])
+	}
+
+	empty := render.ParseTemplOutput("<ul><!--$0+:items--><!--/$0--></ul>")
+	if diff := render.Diff(curr, empty); diff.Dynamic[0] != nil {
+		t.Errorf("Dynamic[0]: got %#v, want nil when nothing was added", diff.Dynamic[0])
+	}
+}
+
+func TestParseStream(t *testing.T) {
+	r := render.ParseTemplOutput(`<ul><!--$0@:songs--><li id="songs-1">a</li><!--/$0--></ul><!--$1:songs-->x<!--/$1-->`)
+
+	if r.Stream[0] != "songs" || r.Stream[1] != "" {
+		t.Errorf("Stream: got %q, want [songs \"\"]", r.Stream)
+	}
+	if r.Append[0] {
+		t.Error("Append: got true for a stream part")
+	}
+}
@@ -2,12 +2,17 @@ package render
 
 import (
 	"regexp"
+	"strings"
 )
 
-var dynamicMarkerRegex = regexp.MustCompile(`<!--\$\d+-->(.*?)<!--/\$\d+-->`)
+var dynamicMarkerRegex = regexp.MustCompile(`(?s)<!--\$\d+([+@])?(?::([^>]*?))?-->(.*?)<!--/\$\d+-->`)
 
 // ParseTemplOutput parses HTML output from templ and extracts static/dynamic parts
-// This is a simple regex-based parser for the initial implementation
+// This is a simple regex-based parser for the initial implementation.
+// A marker may declare the assigns its part depends on, as in
+// <!--$0:count,name-->, which are returned in Deps. A marker with a plus,
+// as in <!--$0+:messages-->, is append-only, see Rendered.Append, and one
+// with an at sign, as in <!--$0@:songs-->, renders the stream it names.
 func ParseTemplOutput(html string) *Rendered {
 	// Find all dynamic markers
 	matches := dynamicMarkerRegex.FindAllStringSubmatchIndex(html, -1)
@@ -22,6 +27,9 @@ func ParseTemplOutput(html string) *Rendered {
 
 	static := []string{}
 	dynamic := []interface{}{}
+	deps := make([][]string, 0, len(matches))
+	appendOnly := make([]bool, 0, len(matches))
+	streams := make([]string, 0, len(matches))
 
 	lastEnd := 0
 	for _, match := range matches {
@@ -29,8 +37,21 @@ func ParseTemplOutput(html string) *Rendered {
 		static = append(static, html[lastEnd:match[0]])
 
 		// Extract dynamic content (inside the markers)
-		dynamicContent := html[match[2]:match[3]]
+		dynamicContent := html[match[6]:match[7]]
 		dynamic = append(dynamic, dynamicContent)
+		partDeps := parseDeps(html, match[4], match[5])
+		deps = append(deps, partDeps)
+
+		flag := ""
+		if match[2] >= 0 {
+			flag = html[match[2]:match[3]]
+		}
+		appendOnly = append(appendOnly, flag == "+")
+		stream := ""
+		if flag == "@" && len(partDeps) > 0 {
+			stream = partDeps[0]
+		}
+		streams = append(streams, stream)
 
 		lastEnd = match[1]
 	}
@@ -43,7 +64,25 @@ func ParseTemplOutput(html string) *Rendered {
 	return &Rendered{
 		Static:  static,
 		Dynamic: dynamic,
+		Deps:    deps,
+		Append:  appendOnly,
+		Stream:  streams,
+	}
+}
+
+// parseDeps returns the comma separated assign names in html[start:end], or
+// nil when the marker declares none
+func parseDeps(html string, start, end int) []string {
+	if start < 0 {
+		return nil
+	}
+	deps := []string{}
+	for _, name := range strings.Split(html[start:end], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			deps = append(deps, name)
+		}
 	}
+	return deps
 }
 
 // ParseTemplOutputWithNesting parses nested components
@@ -24,11 +24,23 @@ type Server struct {
 	connections map[string]*Conn
 	mu          sync.RWMutex
 	handlers    map[string]HandlerFunc
+	onClose     []CloseFunc
+	closing     bool
+	writers     sync.WaitGroup
 }
 
-// HandlerFunc is a function that handles LiveView connections
+// CloseReasonShutdown is the close frame reason sent on Shutdown. Clients
+// reconnect after a jittered delay when they see it.
+const CloseReasonShutdown = "shutdown"
+
+// HandlerFunc is a function that handles LiveView connections. It is
+// invoked synchronously from the connection's read loop, so messages for a
+// connection are delivered in the order they arrived.
 type HandlerFunc func(ctx context.Context, conn *Conn, msg *protocol.Message)
 
+// CloseFunc is called once a connection has been closed
+type CloseFunc func(conn *Conn)
+
 // NewServer creates a new WebSocket server
 func NewServer() *Server {
 	return &Server{
@@ -44,41 +56,121 @@ func (s *Server) RegisterHandler(topic string, handler HandlerFunc) {
 	s.handlers[topic] = handler
 }
 
+// OnClose registers fn to be called whenever a connection closes
+func (s *Server) OnClose(fn CloseFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onClose = append(s.onClose, fn)
+}
+
 // ServeHTTP implements http.Handler
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Refuse early when possible; newConnection makes the final decision
+	s.mu.RLock()
+	closing := s.closing
+	s.mu.RUnlock()
+	if closing {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade failed: %v", err)
 		return
 	}
 
-	c := s.newConnection(conn)
+	c, ok := s.newConnection(conn)
+	if !ok {
+		// Shutdown started during the upgrade
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseServiceRestart, CloseReasonShutdown),
+			time.Now().Add(time.Second))
+		conn.Close()
+		return
+	}
 	go c.readLoop()
-	go c.writeLoop()
+	go func() {
+		defer s.writers.Done()
+		c.writeLoop()
+	}()
+}
+
+// Shutdown stops accepting connections and closes every open connection
+// with a CloseServiceRestart frame carrying CloseReasonShutdown, after the
+// messages already queued for it are written. It waits for all writers to
+// finish or for ctx to be done, in which case the remaining connections are
+// closed immediately and ctx.Err() is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing = true
+	conns := make([]*Conn, 0, len(s.connections))
+	for _, c := range s.connections {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		c.shutdown()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.writers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		for _, c := range conns {
+			c.ws.Close()
+		}
+		return ctx.Err()
+	}
 }
 
 // Conn represents a WebSocket connection
 type Conn struct {
 	server *Server
+	ctx    context.Context
+	cancel context.CancelFunc
 	ws     *websocket.Conn
 	send   chan *protocol.Message
 	id     string
 	topics map[string]bool
 	mu     sync.RWMutex
+
+	// closing is closed to make the write loop flush and say goodbye
+	closing   chan struct{}
+	closeOnce sync.Once
 }
 
-func (s *Server) newConnection(ws *websocket.Conn) *Conn {
+// newConnection registers a connection for ws and counts its writer. It
+// reports false once Shutdown has started, so every registered connection
+// is seen by Shutdown and its writer is counted before Shutdown waits.
+func (s *Server) newConnection(ws *websocket.Conn) (*Conn, bool) {
+	ctx, cancel := context.WithCancel(context.Background())
 	c := &Conn{
-		server: s,
-		ws:     ws,
-		send:   make(chan *protocol.Message, 256),
-		id:     generateID(),
-		topics: make(map[string]bool),
+		server:  s,
+		ctx:     ctx,
+		cancel:  cancel,
+		ws:      ws,
+		send:    make(chan *protocol.Message, 256),
+		id:      generateID(),
+		topics:  make(map[string]bool),
+		closing: make(chan struct{}),
 	}
 	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		cancel()
+		return nil, false
+	}
 	s.connections[c.id] = c
-	s.mu.Unlock()
-	return c
+	s.writers.Add(1)
+	return c, true
 }
 
 func generateID() string {
@@ -98,8 +190,16 @@ func (c *Conn) readLoop() {
 	defer func() {
 		c.server.mu.Lock()
 		delete(c.server.connections, c.id)
+		onClose := append([]CloseFunc(nil), c.server.onClose...)
 		c.server.mu.Unlock()
 		c.ws.Close()
+		c.cancel()
+		// Shutdown no longer sees the connection, so stop its writer here
+		c.shutdown()
+
+		for _, fn := range onClose {
+			fn(c)
+		}
 	}()
 
 	c.ws.SetReadDeadline(time.Now().Add(60 * time.Second))
@@ -134,13 +234,16 @@ func (c *Conn) readLoop() {
 			continue
 		}
 
-		// Dispatch to handler
+		// Dispatch to handler. Handlers are called in order on the read loop
+		// and must not block; the LiveView manager queues work per session.
 		c.server.mu.RLock()
 		handler, ok := c.server.handlers[msg.Topic]
 		c.server.mu.RUnlock()
 
 		if ok {
-			go handler(context.Background(), c, msg)
+			handler(c.ctx, c, msg)
+		} else if msg.Ref != nil {
+			c.Send(protocol.NewErrorReply(msg.Topic, *msg.Ref, protocol.ReasonNotFound))
 		}
 	}
 }
@@ -169,6 +272,13 @@ func (c *Conn) writeLoop() {
 				return
 			}
 
+		case <-c.closing:
+			c.flush()
+			c.ws.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseServiceRestart, CloseReasonShutdown),
+				time.Now().Add(time.Second))
+			return
+
 		case <-ticker.C:
 			c.ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if err := c.ws.WriteMessage(websocket.PingMessage, nil); err != nil {
@@ -178,6 +288,31 @@ func (c *Conn) writeLoop() {
 	}
 }
 
+// flush writes the messages already queued for the connection
+func (c *Conn) flush() {
+	for {
+		select {
+		case msg := <-c.send:
+			data, err := msg.Encode()
+			if err != nil {
+				log.Printf("Failed to encode message: %v", err)
+				continue
+			}
+			c.ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := c.ws.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// shutdown asks the write loop to flush and close the connection
+func (c *Conn) shutdown() {
+	c.closeOnce.Do(func() { close(c.closing) })
+}
+
 // Send sends a message to the client
 func (c *Conn) Send(msg *protocol.Message) {
 	select {
@@ -187,6 +322,36 @@ func (c *Conn) Send(msg *protocol.Message) {
 	}
 }
 
+// Join records topic as joined on this connection
+func (c *Conn) Join(topic string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.topics[topic] = true
+}
+
+// Leave records topic as no longer joined on this connection
+func (c *Conn) Leave(topic string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.topics, topic)
+}
+
+// Topics returns the topics currently joined on this connection
+func (c *Conn) Topics() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	topics := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// Context returns a context that is cancelled when the connection closes
+func (c *Conn) Context() context.Context {
+	return c.ctx
+}
+
 // ID returns the connection ID
 func (c *Conn) ID() string {
 	return c.id
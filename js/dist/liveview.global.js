@@ -1,782 +0,0 @@
-"use strict";
-(() => {
-  // node_modules/morphdom/dist/morphdom-esm.js
-  var DOCUMENT_FRAGMENT_NODE = 11;
-  function morphAttrs(fromNode, toNode) {
-    var toNodeAttrs = toNode.attributes;
-    var attr;
-    var attrName;
-    var attrNamespaceURI;
-    var attrValue;
-    var fromValue;
-    if (toNode.nodeType === DOCUMENT_FRAGMENT_NODE || fromNode.nodeType === DOCUMENT_FRAGMENT_NODE) {
-      return;
-    }
-    for (var i = toNodeAttrs.length - 1; i >= 0; i--) {
-      attr = toNodeAttrs[i];
-      attrName = attr.name;
-      attrNamespaceURI = attr.namespaceURI;
-      attrValue = attr.value;
-      if (attrNamespaceURI) {
-        attrName = attr.localName || attrName;
-        fromValue = fromNode.getAttributeNS(attrNamespaceURI, attrName);
-        if (fromValue !== attrValue) {
-          if (attr.prefix === "xmlns") {
-            attrName = attr.name;
-          }
-          fromNode.setAttributeNS(attrNamespaceURI, attrName, attrValue);
-        }
-      } else {
-        fromValue = fromNode.getAttribute(attrName);
-        if (fromValue !== attrValue) {
-          fromNode.setAttribute(attrName, attrValue);
-        }
-      }
-    }
-    var fromNodeAttrs = fromNode.attributes;
-    for (var d = fromNodeAttrs.length - 1; d >= 0; d--) {
-      attr = fromNodeAttrs[d];
-      attrName = attr.name;
-      attrNamespaceURI = attr.namespaceURI;
-      if (attrNamespaceURI) {
-        attrName = attr.localName || attrName;
-        if (!toNode.hasAttributeNS(attrNamespaceURI, attrName)) {
-          fromNode.removeAttributeNS(attrNamespaceURI, attrName);
-        }
-      } else {
-        if (!toNode.hasAttribute(attrName)) {
-          fromNode.removeAttribute(attrName);
-        }
-      }
-    }
-  }
-  var range;
-  var NS_XHTML = "http://www.w3.org/1999/xhtml";
-  var doc = typeof document === "undefined" ? void 0 : document;
-  var HAS_TEMPLATE_SUPPORT = !!doc && "content" in doc.createElement("template");
-  var HAS_RANGE_SUPPORT = !!doc && doc.createRange && "createContextualFragment" in doc.createRange();
-  function createFragmentFromTemplate(str) {
-    var template = doc.createElement("template");
-    template.innerHTML = str;
-    return template.content.childNodes[0];
-  }
-  function createFragmentFromRange(str) {
-    if (!range) {
-      range = doc.createRange();
-      range.selectNode(doc.body);
-    }
-    var fragment = range.createContextualFragment(str);
-    return fragment.childNodes[0];
-  }
-  function createFragmentFromWrap(str) {
-    var fragment = doc.createElement("body");
-    fragment.innerHTML = str;
-    return fragment.childNodes[0];
-  }
-  function toElement(str) {
-    str = str.trim();
-    if (HAS_TEMPLATE_SUPPORT) {
-      return createFragmentFromTemplate(str);
-    } else if (HAS_RANGE_SUPPORT) {
-      return createFragmentFromRange(str);
-    }
-    return createFragmentFromWrap(str);
-  }
-  function compareNodeNames(fromEl, toEl) {
-    var fromNodeName = fromEl.nodeName;
-    var toNodeName = toEl.nodeName;
-    var fromCodeStart, toCodeStart;
-    if (fromNodeName === toNodeName) {
-      return true;
-    }
-    fromCodeStart = fromNodeName.charCodeAt(0);
-    toCodeStart = toNodeName.charCodeAt(0);
-    if (fromCodeStart <= 90 && toCodeStart >= 97) {
-      return fromNodeName === toNodeName.toUpperCase();
-    } else if (toCodeStart <= 90 && fromCodeStart >= 97) {
-      return toNodeName === fromNodeName.toUpperCase();
-    } else {
-      return false;
-    }
-  }
-  function createElementNS(name, namespaceURI) {
-    return !namespaceURI || namespaceURI === NS_XHTML ? doc.createElement(name) : doc.createElementNS(namespaceURI, name);
-  }
-  function moveChildren(fromEl, toEl) {
-    var curChild = fromEl.firstChild;
-    while (curChild) {
-      var nextChild = curChild.nextSibling;
-      toEl.appendChild(curChild);
-      curChild = nextChild;
-    }
-    return toEl;
-  }
-  function syncBooleanAttrProp(fromEl, toEl, name) {
-    if (fromEl[name] !== toEl[name]) {
-      fromEl[name] = toEl[name];
-      if (fromEl[name]) {
-        fromEl.setAttribute(name, "");
-      } else {
-        fromEl.removeAttribute(name);
-      }
-    }
-  }
-  var specialElHandlers = {
-    OPTION: function(fromEl, toEl) {
-      var parentNode = fromEl.parentNode;
-      if (parentNode) {
-        var parentName = parentNode.nodeName.toUpperCase();
-        if (parentName === "OPTGROUP") {
-          parentNode = parentNode.parentNode;
-          parentName = parentNode && parentNode.nodeName.toUpperCase();
-        }
-        if (parentName === "SELECT" && !parentNode.hasAttribute("multiple")) {
-          if (fromEl.hasAttribute("selected") && !toEl.selected) {
-            fromEl.setAttribute("selected", "selected");
-            fromEl.removeAttribute("selected");
-          }
-          parentNode.selectedIndex = -1;
-        }
-      }
-      syncBooleanAttrProp(fromEl, toEl, "selected");
-    },
-    /**
-     * The "value" attribute is special for the <input> element since it sets
-     * the initial value. Changing the "value" attribute without changing the
-     * "value" property will have no effect since it is only used to the set the
-     * initial value.  Similar for the "checked" attribute, and "disabled".
-     */
-    INPUT: function(fromEl, toEl) {
-      syncBooleanAttrProp(fromEl, toEl, "checked");
-      syncBooleanAttrProp(fromEl, toEl, "disabled");
-      if (fromEl.value !== toEl.value) {
-        fromEl.value = toEl.value;
-      }
-      if (!toEl.hasAttribute("value")) {
-        fromEl.removeAttribute("value");
-      }
-    },
-    TEXTAREA: function(fromEl, toEl) {
-      var newValue = toEl.value;
-      if (fromEl.value !== newValue) {
-        fromEl.value = newValue;
-      }
-      var firstChild = fromEl.firstChild;
-      if (firstChild) {
-        var oldValue = firstChild.nodeValue;
-        if (oldValue == newValue || !newValue && oldValue == fromEl.placeholder) {
-          return;
-        }
-        firstChild.nodeValue = newValue;
-      }
-    },
-    SELECT: function(fromEl, toEl) {
-      if (!toEl.hasAttribute("multiple")) {
-        var selectedIndex = -1;
-        var i = 0;
-        var curChild = fromEl.firstChild;
-        var optgroup;
-        var nodeName;
-        while (curChild) {
-          nodeName = curChild.nodeName && curChild.nodeName.toUpperCase();
-          if (nodeName === "OPTGROUP") {
-            optgroup = curChild;
-            curChild = optgroup.firstChild;
-            if (!curChild) {
-              curChild = optgroup.nextSibling;
-              optgroup = null;
-            }
-          } else {
-            if (nodeName === "OPTION") {
-              if (curChild.hasAttribute("selected")) {
-                selectedIndex = i;
-                break;
-              }
-              i++;
-            }
-            curChild = curChild.nextSibling;
-            if (!curChild && optgroup) {
-              curChild = optgroup.nextSibling;
-              optgroup = null;
-            }
-          }
-        }
-        fromEl.selectedIndex = selectedIndex;
-      }
-    }
-  };
-  var ELEMENT_NODE = 1;
-  var DOCUMENT_FRAGMENT_NODE$1 = 11;
-  var TEXT_NODE = 3;
-  var COMMENT_NODE = 8;
-  function noop() {
-  }
-  function defaultGetNodeKey(node) {
-    if (node) {
-      return node.getAttribute && node.getAttribute("id") || node.id;
-    }
-  }
-  function morphdomFactory(morphAttrs2) {
-    return function morphdom2(fromNode, toNode, options) {
-      if (!options) {
-        options = {};
-      }
-      if (typeof toNode === "string") {
-        if (fromNode.nodeName === "#document" || fromNode.nodeName === "HTML") {
-          var toNodeHtml = toNode;
-          toNode = doc.createElement("html");
-          toNode.innerHTML = toNodeHtml;
-        } else if (fromNode.nodeName === "BODY") {
-          var toNodeBody = toNode;
-          toNode = doc.createElement("html");
-          toNode.innerHTML = toNodeBody;
-          var bodyElement = toNode.querySelector("body");
-          if (bodyElement) {
-            toNode = bodyElement;
-          }
-        } else {
-          toNode = toElement(toNode);
-        }
-      } else if (toNode.nodeType === DOCUMENT_FRAGMENT_NODE$1) {
-        toNode = toNode.firstElementChild;
-      }
-      var getNodeKey = options.getNodeKey || defaultGetNodeKey;
-      var onBeforeNodeAdded = options.onBeforeNodeAdded || noop;
-      var onNodeAdded = options.onNodeAdded || noop;
-      var onBeforeElUpdated = options.onBeforeElUpdated || noop;
-      var onElUpdated = options.onElUpdated || noop;
-      var onBeforeNodeDiscarded = options.onBeforeNodeDiscarded || noop;
-      var onNodeDiscarded = options.onNodeDiscarded || noop;
-      var onBeforeElChildrenUpdated = options.onBeforeElChildrenUpdated || noop;
-      var skipFromChildren = options.skipFromChildren || noop;
-      var addChild = options.addChild || function(parent, child) {
-        return parent.appendChild(child);
-      };
-      var childrenOnly = options.childrenOnly === true;
-      var fromNodesLookup = /* @__PURE__ */ Object.create(null);
-      var keyedRemovalList = [];
-      function addKeyedRemoval(key) {
-        keyedRemovalList.push(key);
-      }
-      function walkDiscardedChildNodes(node, skipKeyedNodes) {
-        if (node.nodeType === ELEMENT_NODE) {
-          var curChild = node.firstChild;
-          while (curChild) {
-            var key = void 0;
-            if (skipKeyedNodes && (key = getNodeKey(curChild))) {
-              addKeyedRemoval(key);
-            } else {
-              onNodeDiscarded(curChild);
-              if (curChild.firstChild) {
-                walkDiscardedChildNodes(curChild, skipKeyedNodes);
-              }
-            }
-            curChild = curChild.nextSibling;
-          }
-        }
-      }
-      function removeNode(node, parentNode, skipKeyedNodes) {
-        if (onBeforeNodeDiscarded(node) === false) {
-          return;
-        }
-        if (parentNode) {
-          parentNode.removeChild(node);
-        }
-        onNodeDiscarded(node);
-        walkDiscardedChildNodes(node, skipKeyedNodes);
-      }
-      function indexTree(node) {
-        if (node.nodeType === ELEMENT_NODE || node.nodeType === DOCUMENT_FRAGMENT_NODE$1) {
-          var curChild = node.firstChild;
-          while (curChild) {
-            var key = getNodeKey(curChild);
-            if (key) {
-              fromNodesLookup[key] = curChild;
-            }
-            indexTree(curChild);
-            curChild = curChild.nextSibling;
-          }
-        }
-      }
-      indexTree(fromNode);
-      function handleNodeAdded(el) {
-        onNodeAdded(el);
-        var curChild = el.firstChild;
-        while (curChild) {
-          var nextSibling = curChild.nextSibling;
-          var key = getNodeKey(curChild);
-          if (key) {
-            var unmatchedFromEl = fromNodesLookup[key];
-            if (unmatchedFromEl && compareNodeNames(curChild, unmatchedFromEl)) {
-              curChild.parentNode.replaceChild(unmatchedFromEl, curChild);
-              morphEl(unmatchedFromEl, curChild);
-            } else {
-              handleNodeAdded(curChild);
-            }
-          } else {
-            handleNodeAdded(curChild);
-          }
-          curChild = nextSibling;
-        }
-      }
-      function cleanupFromEl(fromEl, curFromNodeChild, curFromNodeKey) {
-        while (curFromNodeChild) {
-          var fromNextSibling = curFromNodeChild.nextSibling;
-          if (curFromNodeKey = getNodeKey(curFromNodeChild)) {
-            addKeyedRemoval(curFromNodeKey);
-          } else {
-            removeNode(
-              curFromNodeChild,
-              fromEl,
-              true
-              /* skip keyed nodes */
-            );
-          }
-          curFromNodeChild = fromNextSibling;
-        }
-      }
-      function morphEl(fromEl, toEl, childrenOnly2) {
-        var toElKey = getNodeKey(toEl);
-        if (toElKey) {
-          delete fromNodesLookup[toElKey];
-        }
-        if (!childrenOnly2) {
-          var beforeUpdateResult = onBeforeElUpdated(fromEl, toEl);
-          if (beforeUpdateResult === false) {
-            return;
-          } else if (beforeUpdateResult instanceof HTMLElement) {
-            fromEl = beforeUpdateResult;
-            indexTree(fromEl);
-          }
-          morphAttrs2(fromEl, toEl);
-          onElUpdated(fromEl);
-          if (onBeforeElChildrenUpdated(fromEl, toEl) === false) {
-            return;
-          }
-        }
-        if (fromEl.nodeName !== "TEXTAREA") {
-          morphChildren(fromEl, toEl);
-        } else {
-          specialElHandlers.TEXTAREA(fromEl, toEl);
-        }
-      }
-      function morphChildren(fromEl, toEl) {
-        var skipFrom = skipFromChildren(fromEl, toEl);
-        var curToNodeChild = toEl.firstChild;
-        var curFromNodeChild = fromEl.firstChild;
-        var curToNodeKey;
-        var curFromNodeKey;
-        var fromNextSibling;
-        var toNextSibling;
-        var matchingFromEl;
-        outer: while (curToNodeChild) {
-          toNextSibling = curToNodeChild.nextSibling;
-          curToNodeKey = getNodeKey(curToNodeChild);
-          while (!skipFrom && curFromNodeChild) {
-            fromNextSibling = curFromNodeChild.nextSibling;
-            if (curToNodeChild.isSameNode && curToNodeChild.isSameNode(curFromNodeChild)) {
-              curToNodeChild = toNextSibling;
-              curFromNodeChild = fromNextSibling;
-              continue outer;
-            }
-            curFromNodeKey = getNodeKey(curFromNodeChild);
-            var curFromNodeType = curFromNodeChild.nodeType;
-            var isCompatible = void 0;
-            if (curFromNodeType === curToNodeChild.nodeType) {
-              if (curFromNodeType === ELEMENT_NODE) {
-                if (curToNodeKey) {
-                  if (curToNodeKey !== curFromNodeKey) {
-                    if (matchingFromEl = fromNodesLookup[curToNodeKey]) {
-                      if (fromNextSibling === matchingFromEl) {
-                        isCompatible = false;
-                      } else {
-                        fromEl.insertBefore(matchingFromEl, curFromNodeChild);
-                        if (curFromNodeKey) {
-                          addKeyedRemoval(curFromNodeKey);
-                        } else {
-                          removeNode(
-                            curFromNodeChild,
-                            fromEl,
-                            true
-                            /* skip keyed nodes */
-                          );
-                        }
-                        curFromNodeChild = matchingFromEl;
-                        curFromNodeKey = getNodeKey(curFromNodeChild);
-                      }
-                    } else {
-                      isCompatible = false;
-                    }
-                  }
-                } else if (curFromNodeKey) {
-                  isCompatible = false;
-                }
-                isCompatible = isCompatible !== false && compareNodeNames(curFromNodeChild, curToNodeChild);
-                if (isCompatible) {
-                  morphEl(curFromNodeChild, curToNodeChild);
-                }
-              } else if (curFromNodeType === TEXT_NODE || curFromNodeType == COMMENT_NODE) {
-                isCompatible = true;
-                if (curFromNodeChild.nodeValue !== curToNodeChild.nodeValue) {
-                  curFromNodeChild.nodeValue = curToNodeChild.nodeValue;
-                }
-              }
-            }
-            if (isCompatible) {
-              curToNodeChild = toNextSibling;
-              curFromNodeChild = fromNextSibling;
-              continue outer;
-            }
-            if (curFromNodeKey) {
-              addKeyedRemoval(curFromNodeKey);
-            } else {
-              removeNode(
-                curFromNodeChild,
-                fromEl,
-                true
-                /* skip keyed nodes */
-              );
-            }
-            curFromNodeChild = fromNextSibling;
-          }
-          if (curToNodeKey && (matchingFromEl = fromNodesLookup[curToNodeKey]) && compareNodeNames(matchingFromEl, curToNodeChild)) {
-            if (!skipFrom) {
-              addChild(fromEl, matchingFromEl);
-            }
-            morphEl(matchingFromEl, curToNodeChild);
-          } else {
-            var onBeforeNodeAddedResult = onBeforeNodeAdded(curToNodeChild);
-            if (onBeforeNodeAddedResult !== false) {
-              if (onBeforeNodeAddedResult) {
-                curToNodeChild = onBeforeNodeAddedResult;
-              }
-              if (curToNodeChild.actualize) {
-                curToNodeChild = curToNodeChild.actualize(fromEl.ownerDocument || doc);
-              }
-              addChild(fromEl, curToNodeChild);
-              handleNodeAdded(curToNodeChild);
-            }
-          }
-          curToNodeChild = toNextSibling;
-          curFromNodeChild = fromNextSibling;
-        }
-        cleanupFromEl(fromEl, curFromNodeChild, curFromNodeKey);
-        var specialElHandler = specialElHandlers[fromEl.nodeName];
-        if (specialElHandler) {
-          specialElHandler(fromEl, toEl);
-        }
-      }
-      var morphedNode = fromNode;
-      var morphedNodeType = morphedNode.nodeType;
-      var toNodeType = toNode.nodeType;
-      if (!childrenOnly) {
-        if (morphedNodeType === ELEMENT_NODE) {
-          if (toNodeType === ELEMENT_NODE) {
-            if (!compareNodeNames(fromNode, toNode)) {
-              onNodeDiscarded(fromNode);
-              morphedNode = moveChildren(fromNode, createElementNS(toNode.nodeName, toNode.namespaceURI));
-            }
-          } else {
-            morphedNode = toNode;
-          }
-        } else if (morphedNodeType === TEXT_NODE || morphedNodeType === COMMENT_NODE) {
-          if (toNodeType === morphedNodeType) {
-            if (morphedNode.nodeValue !== toNode.nodeValue) {
-              morphedNode.nodeValue = toNode.nodeValue;
-            }
-            return morphedNode;
-          } else {
-            morphedNode = toNode;
-          }
-        }
-      }
-      if (morphedNode === toNode) {
-        onNodeDiscarded(fromNode);
-      } else {
-        if (toNode.isSameNode && toNode.isSameNode(morphedNode)) {
-          return;
-        }
-        morphEl(morphedNode, toNode, childrenOnly);
-        if (keyedRemovalList) {
-          for (var i = 0, len = keyedRemovalList.length; i < len; i++) {
-            var elToRemove = fromNodesLookup[keyedRemovalList[i]];
-            if (elToRemove) {
-              removeNode(elToRemove, elToRemove.parentNode, false);
-            }
-          }
-        }
-      }
-      if (!childrenOnly && morphedNode !== fromNode && fromNode.parentNode) {
-        if (morphedNode.actualize) {
-          morphedNode = morphedNode.actualize(fromNode.ownerDocument || doc);
-        }
-        fromNode.parentNode.replaceChild(morphedNode, fromNode);
-      }
-      return morphedNode;
-    };
-  }
-  var morphdom = morphdomFactory(morphAttrs);
-  var morphdom_esm_default = morphdom;
-
-  // src/renderer.ts
-  var Renderer = class {
-    constructor(container) {
-      this.static = null;
-      this.container = container;
-    }
-    // Apply a patch to the DOM
-    apply(patch) {
-      if (patch.s) {
-        this.static = patch.s;
-      }
-      if (!this.static) {
-        throw new Error("No static template received");
-      }
-      const html = this.build(this.static, patch.d);
-      morphdom_esm_default(this.container, `<div>${html}</div>`, {
-        childrenOnly: true,
-        onBeforeElUpdated: (fromEl, toEl) => {
-          if (fromEl === document.activeElement) {
-            return false;
-          }
-          return true;
-        }
-      });
-    }
-    // Build HTML string from static and dynamic parts
-    build(staticParts, dynamicParts) {
-      let result = "";
-      for (let i = 0; i < staticParts.length; i++) {
-        result += staticParts[i];
-        if (i < dynamicParts.length) {
-          result += this.renderDynamic(dynamicParts[i]);
-        }
-      }
-      return result;
-    }
-    // Render a dynamic value to string
-    renderDynamic(value) {
-      if (value === null || value === void 0) {
-        return "";
-      }
-      if (typeof value === "string") {
-        return this.escapeHtml(value);
-      }
-      if (typeof value === "number" || typeof value === "boolean") {
-        return String(value);
-      }
-      if (Array.isArray(value)) {
-        return value.map((v) => this.renderDynamic(v)).join("");
-      }
-      if (value.s && value.d) {
-        return this.build(value.s, value.d);
-      }
-      return "";
-    }
-    // Escape HTML entities
-    escapeHtml(text) {
-      const div = document.createElement("div");
-      div.textContent = text;
-      return div.innerHTML;
-    }
-  };
-  var LiveViewRenderer = class {
-    constructor(containerId) {
-      const container = document.getElementById(containerId);
-      if (!container) {
-        throw new Error(`Container #${containerId} not found`);
-      }
-      this.container = container;
-      this.renderer = new Renderer(container);
-    }
-    render(patch) {
-      this.renderer.apply(patch);
-    }
-    // Set up event delegation for LiveView events
-    setupEventDelegation(pushEvent) {
-      this.container.addEventListener("click", (e) => {
-        const target = e.target;
-        const phxClick = target.closest("[phx-click]");
-        if (phxClick) {
-          e.preventDefault();
-          const event = phxClick.getAttribute("phx-click");
-          const value = phxClick.getAttribute("phx-value") || {};
-          pushEvent(event, { value });
-        }
-      });
-      this.container.addEventListener("input", (e) => {
-        const target = e.target;
-        const phxChange = target.closest("[phx-change]");
-        if (phxChange) {
-          const event = phxChange.getAttribute("phx-change");
-          pushEvent(event, { value: target.value });
-        }
-      });
-      this.container.addEventListener("submit", (e) => {
-        const target = e.target;
-        const phxSubmit = target.closest("[phx-submit]");
-        if (phxSubmit) {
-          e.preventDefault();
-          const event = phxSubmit.getAttribute("phx-submit");
-          const formData = new FormData(target);
-          const data = {};
-          formData.forEach((value, key) => {
-            data[key] = value.toString();
-          });
-          pushEvent(event, data);
-        }
-      });
-    }
-  };
-
-  // src/liveview.ts
-  var LiveSocket = class {
-    constructor(url, opts = {}) {
-      this.socket = null;
-      this.channels = /* @__PURE__ */ new Map();
-      this.reconnectAttempts = 0;
-      this.maxReconnectAttempts = 10;
-      this.reconnectDelay = 1e3;
-      this.url = url;
-      this.params = opts.params || {};
-    }
-    connect() {
-      const wsUrl = this.url.startsWith("ws") ? this.url : `ws://${window.location.host}${this.url}`;
-      this.socket = new WebSocket(wsUrl);
-      this.socket.onopen = () => {
-        console.log("LiveSocket connected");
-        this.reconnectAttempts = 0;
-        this.channels.forEach((channel) => {
-          channel.rejoin();
-        });
-      };
-      this.socket.onmessage = (event) => {
-        const msg = JSON.parse(event.data);
-        this.handleMessage(msg);
-      };
-      this.socket.onclose = () => {
-        console.log("LiveSocket disconnected");
-        this.attemptReconnect();
-      };
-      this.socket.onerror = (error) => {
-        console.error("LiveSocket error:", error);
-      };
-    }
-    channel(topic, params = {}) {
-      const channel = new Channel(this, topic, params);
-      this.channels.set(topic, channel);
-      return channel;
-    }
-    isConnected() {
-      return this.socket !== null && this.socket.readyState === WebSocket.OPEN;
-    }
-    push(topic, event, payload, ref) {
-      if (!this.socket || this.socket.readyState !== WebSocket.OPEN) {
-        console.error("Socket not connected");
-        return;
-      }
-      const msg = {
-        topic,
-        event,
-        payload,
-        ref: ref || this.makeRef()
-      };
-      this.socket.send(JSON.stringify(msg));
-    }
-    handleMessage(msg) {
-      const channel = this.channels.get(msg.topic);
-      if (channel) {
-        channel.handleMessage(msg);
-      }
-    }
-    attemptReconnect() {
-      if (this.reconnectAttempts >= this.maxReconnectAttempts) {
-        console.error("Max reconnection attempts reached");
-        return;
-      }
-      this.reconnectAttempts++;
-      const delay = this.reconnectDelay * Math.pow(2, this.reconnectAttempts - 1);
-      setTimeout(() => {
-        console.log(`Reconnecting... (attempt ${this.reconnectAttempts})`);
-        this.connect();
-      }, delay);
-    }
-    makeRef() {
-      return Math.random().toString(36).substring(2, 15);
-    }
-  };
-  var Channel = class {
-    constructor(socket, topic, params) {
-      this.state = "closed";
-      this.bindings = /* @__PURE__ */ new Map();
-      this.joinRef = null;
-      this.socket = socket;
-      this.topic = topic;
-      this.params = params;
-    }
-    join() {
-      if (this.state === "joined" || this.state === "joining") {
-        return;
-      }
-      if (!this.socket.isConnected()) {
-        this.state = "pending";
-        return;
-      }
-      this.state = "joining";
-      this.joinRef = this.makeRef();
-      this.socket.push(this.topic, "phx_join", {
-        params: this.params,
-        session: "",
-        static: ""
-      }, this.joinRef);
-    }
-    rejoin() {
-      this.state = "closed";
-      this.join();
-    }
-    on(event, callback) {
-      if (!this.bindings.has(event)) {
-        this.bindings.set(event, []);
-      }
-      this.bindings.get(event).push(callback);
-    }
-    push(event, payload) {
-      this.socket.push(this.topic, "event", {
-        type: "click",
-        event,
-        value: payload
-      });
-    }
-    handleMessage(msg) {
-      if (msg.event === "phx_reply" && msg.ref === this.joinRef) {
-        const payload2 = typeof msg.payload === "string" ? JSON.parse(msg.payload) : msg.payload;
-        if (payload2.status === "ok") {
-          this.state = "joined";
-          this.trigger("join", payload2.response);
-        } else {
-          this.state = "errored";
-          this.trigger("error", payload2);
-        }
-        return;
-      }
-      if (msg.event === "diff") {
-        const payload2 = typeof msg.payload === "string" ? JSON.parse(msg.payload) : msg.payload;
-        this.trigger("diff", payload2);
-        return;
-      }
-      const payload = typeof msg.payload === "string" ? JSON.parse(msg.payload) : msg.payload;
-      this.trigger(msg.event, payload);
-    }
-    trigger(event, payload) {
-      const handlers = this.bindings.get(event);
-      if (handlers) {
-        handlers.forEach((handler) => handler(payload));
-      }
-    }
-    makeRef() {
-      return Math.random().toString(36).substring(2, 15);
-    }
-  };
-  window.LiveSocket = LiveSocket;
-  window.LiveViewRenderer = LiveViewRenderer;
-})();
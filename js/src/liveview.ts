@@ -1,5 +1,40 @@
 import { LiveViewRenderer } from './renderer';
 
+// LiveSocketOptions - Configuration for LiveSocket
+export interface LiveSocketOptions {
+  params?: Record<string, string>;
+  // Delay before the n-th consecutive rejoin attempt of an errored channel
+  rejoinAfterMs?: (tries: number) => number;
+  maxRejoinAttempts?: number;
+}
+
+// ChannelError - Payload of the channel 'error' binding
+export interface ChannelError {
+  reason: string;
+  kind: 'join' | 'reply' | 'crash';
+}
+
+interface ReplyHandler {
+  ok: (response: any) => void;
+  error?: (response: any) => void;
+}
+
+// Reasons the server uses when retrying cannot help
+const fatalReasons = ['unauthorized', 'not_found', 'too_many_restarts'];
+
+// Close code and delay window used when the server shuts down gracefully
+const SERVICE_RESTART = 1012;
+const SHUTDOWN_RECONNECT_MIN_MS = 1000;
+const SHUTDOWN_RECONNECT_JITTER_MS = 4000;
+// Spread page reloads of clients told their assets are outdated
+const STALE_STATIC_RELOAD_JITTER_MS = 2000;
+// Cookie carrying the signed flash to a regular page after a redirect
+const FLASH_COOKIE = '_lv_flash';
+
+function defaultRejoinAfterMs(tries: number): number {
+  return [100, 500, 1000, 2000][tries - 1] || 5000;
+}
+
 // LiveSocket - Main entry point for the LiveView client
 export class LiveSocket {
   private url: string;
@@ -9,10 +44,17 @@ export class LiveSocket {
   private reconnectAttempts = 0;
   private maxReconnectAttempts = 10;
   private reconnectDelay = 1000;
+  rejoinAfterMs: (tries: number) => number;
+  maxRejoinAttempts: number;
+  // Digest of the tracked assets the page was loaded with
+  staticDigest = '';
 
-  constructor(url: string, opts: { params?: Record<string, string> } = {}) {
+  constructor(url: string, opts: LiveSocketOptions = {}) {
     this.url = url;
     this.params = opts.params || {};
+    this.rejoinAfterMs = opts.rejoinAfterMs || defaultRejoinAfterMs;
+    this.maxRejoinAttempts = opts.maxRejoinAttempts ?? 10;
+    window.addEventListener('popstate', (e) => this.handlePopState(e));
   }
 
   connect(): void {
@@ -34,8 +76,15 @@ export class LiveSocket {
       this.handleMessage(msg);
     };
 
-    this.socket.onclose = () => {
+    this.socket.onclose = (event) => {
       console.log('LiveSocket disconnected');
+      // The server is restarting; spread the reconnects of all clients
+      // instead of backing off
+      if (event.code === SERVICE_RESTART && event.reason === 'shutdown') {
+        this.reconnectAttempts = 0;
+        this.scheduleReconnect(SHUTDOWN_RECONNECT_MIN_MS + Math.random() * SHUTDOWN_RECONNECT_JITTER_MS);
+        return;
+      }
       this.attemptReconnect();
     };
 
@@ -44,23 +93,75 @@ export class LiveSocket {
     };
   }
 
-  channel(topic: string, params: Record<string, any> = {}): Channel {
-    const channel = new Channel(this, topic, params);
+  // Patch the URL of every joined channel, e.g. after browser back/forward
+  // History entries left by a live redirect belong to a LiveView that is
+  // no longer joined, so those reload the page instead.
+  private handlePopState(e: PopStateEvent): void {
+    const topic = e.state && e.state.phx;
+    if (topic && !this.channels.has(topic)) {
+      window.location.reload();
+      return;
+    }
+    this.channels.forEach(channel => channel.patch(window.location.href, 'pop'));
+  }
+
+  channel(topic: string, params: Record<string, any> = {}, session = ''): Channel {
+    const channel = new Channel(this, topic, params, session);
     this.channels.set(topic, channel);
     return channel;
   }
 
+  // Re-register channel under a new topic after a live redirect
+  moveChannel(channel: Channel, topic: string): void {
+    if (this.channels.get(channel.topic) === channel) {
+      this.channels.delete(channel.topic);
+    }
+    this.channels.set(topic, channel);
+  }
+
+  // Join the LiveView whose topic is set in the data-phx-topic attribute of
+  // the container, and render it into that container
+  mount(containerId = 'live-view-root', params: Record<string, any> = {}): Channel | null {
+    const container = document.getElementById(containerId);
+    const topic = container && container.getAttribute('data-phx-topic');
+    if (!container || !topic) {
+      return null;
+    }
+
+    // The container already holds the server-rendered page; the join reply
+    // is morphed over it, so unchanged content is left untouched
+    const session = container.getAttribute('data-phx-session') || '';
+    this.staticDigest = container.getAttribute('data-phx-static') || '';
+    const channel = this.channel(topic, params, session);
+    const renderer = new LiveViewRenderer(containerId);
+    renderer.setupEventDelegation(
+      (event, payload) => channel.push(event, payload),
+      (href, kind) => kind === 'patch' ? channel.patch(href) : channel.navigate(href)
+    );
+
+    channel.on('join', (response) => {
+      if (response && response.rendered) {
+        renderer.render(response.rendered);
+      }
+    });
+    channel.on('diff', (diff) => renderer.render(diff));
+    channel.on('navigate', ({ topic }) => container.setAttribute('data-phx-topic', topic));
+    channel.join();
+    return channel;
+  }
+
   isConnected(): boolean {
     return this.socket !== null && this.socket.readyState === WebSocket.OPEN;
   }
 
-  push(topic: string, event: string, payload: any, ref?: string): void {
+  push(topic: string, event: string, payload: any, ref?: string, joinRef?: string | null): string | null {
     if (!this.socket || this.socket.readyState !== WebSocket.OPEN) {
       console.error('Socket not connected');
-      return;
+      return null;
     }
 
     const msg = {
+      join_ref: joinRef || undefined,
       topic,
       event,
       payload,
@@ -68,6 +169,7 @@ export class LiveSocket {
     };
 
     this.socket.send(JSON.stringify(msg));
+    return msg.ref;
   }
 
   private handleMessage(msg: any): void {
@@ -84,8 +186,10 @@ export class LiveSocket {
     }
 
     this.reconnectAttempts++;
-    const delay = this.reconnectDelay * Math.pow(2, this.reconnectAttempts - 1);
-    
+    this.scheduleReconnect(this.reconnectDelay * Math.pow(2, this.reconnectAttempts - 1));
+  }
+
+  private scheduleReconnect(delay: number): void {
     setTimeout(() => {
       console.log(`Reconnecting... (attempt ${this.reconnectAttempts})`);
       this.connect();
@@ -104,14 +208,22 @@ export class Channel {
   private socket: LiveSocket;
   topic: string;
   private params: Record<string, any>;
+  private session: string;
   private state: ChannelState = 'closed';
   private bindings: Map<string, ((payload: any) => void)[]> = new Map();
   private joinRef: string | null = null;
+  private rejoinTries = 0;
+  // Successful joins of the current topic, sent as _mounts so the server
+  // can tell a reconnect from a first mount
+  private mounts = 0;
+  private rejoinTimer: ReturnType<typeof setTimeout> | null = null;
+  private replyHandlers: Map<string, ReplyHandler> = new Map();
 
-  constructor(socket: LiveSocket, topic: string, params: Record<string, any>) {
+  constructor(socket: LiveSocket, topic: string, params: Record<string, any>, session = '') {
     this.socket = socket;
     this.topic = topic;
     this.params = params;
+    this.session = session;
   }
 
   join(): void {
@@ -129,13 +241,79 @@ export class Channel {
     this.joinRef = this.makeRef();
     
     this.socket.push(this.topic, 'phx_join', {
-      params: this.params,
-      session: '',
-      static: ''
-    }, this.joinRef);
+      params: { ...this.params, _mounts: this.mounts },
+      session: this.session,
+      static: this.socket.staticDigest,
+      url: window.location.href
+    }, this.joinRef, this.joinRef);
+  }
+
+  // Change the URL without remounting; the server calls HandleParams and
+  // replies with the diff. 'pop' is used when the browser already moved.
+  patch(href: string, kind: 'push' | 'replace' | 'pop' = 'push'): void {
+    if (this.state !== 'joined') {
+      return;
+    }
+
+    const url = new URL(href, window.location.href).toString();
+    if (kind === 'push') {
+      history.pushState({ phx: this.topic }, '', url);
+    } else if (kind === 'replace') {
+      history.replaceState({ phx: this.topic }, '', url);
+    }
+
+    const ref = this.socket.push(this.topic, 'live_patch', { url }, undefined, this.joinRef);
+    if (ref) {
+      this.replyHandlers.set(ref, {
+        ok: (response) => {
+          if (response && response.diff) {
+            this.trigger('diff', response.diff);
+          }
+        }
+      });
+    }
+  }
+
+  // Navigate to another LiveView over the same connection. Paths the
+  // server does not know fall back to a full page load.
+  navigate(href: string): void {
+    const url = new URL(href, window.location.href).toString();
+    if (this.state !== 'joined') {
+      window.location.href = url;
+      return;
+    }
+
+    const ref = this.socket.push(this.topic, 'live_redirect', { url }, undefined, this.joinRef);
+    if (!ref) {
+      window.location.href = url;
+      return;
+    }
+    this.replyHandlers.set(ref, {
+      ok: (response) => {
+        history.pushState({ phx: response.topic }, '', url);
+        this.switchTopic(response.topic, response.session);
+      },
+      error: () => {
+        window.location.href = url;
+      }
+    });
+  }
+
+  // Rejoin this channel on another topic after the server ended the
+  // current LiveView
+  private switchTopic(topic: string, session = ''): void {
+    this.socket.moveChannel(this, topic);
+    this.topic = topic;
+    this.session = session;
+    this.state = 'closed';
+    this.mounts = 0;
+    this.replyHandlers.clear();
+    this.trigger('navigate', { topic });
+    this.join();
   }
 
   rejoin(): void {
+    this.clearRejoinTimer();
     this.state = 'closed';
     this.join();
   }
@@ -147,25 +325,106 @@ export class Channel {
     this.bindings.get(event)!.push(callback);
   }
 
+  // Clear the flash of kind, or all flashes when kind is omitted
+  clearFlash(kind = ''): void {
+    this.push('lv:clear-flash', { value: kind });
+  }
+
   push(event: string, payload: any): void {
     this.socket.push(this.topic, 'event', {
       type: 'click',
       event: event,
       value: payload
-    });
+    }, undefined, this.joinRef);
+  }
+
+  leave(): void {
+    if (this.state === 'joined' || this.state === 'joining') {
+      this.socket.push(this.topic, 'phx_leave', {}, undefined, this.joinRef);
+    }
+    this.clearRejoinTimer();
+    this.state = 'closed';
   }
 
   handleMessage(msg: any): void {
+    // Ignore messages addressed to an earlier join of this topic
+    if (msg.join_ref && this.joinRef && msg.join_ref !== this.joinRef) {
+      return;
+    }
+
     // Handle join reply
     if (msg.event === 'phx_reply' && msg.ref === this.joinRef) {
       const payload = typeof msg.payload === 'string' ? JSON.parse(msg.payload) : msg.payload;
       if (payload.status === 'ok') {
         this.state = 'joined';
+        this.rejoinTries = 0;
+        this.mounts++;
         this.trigger('join', payload.response);
       } else {
-        this.state = 'errored';
-        this.trigger('error', payload);
+        this.handleError(payload.response?.reason, 'join');
+      }
+      return;
+    }
+
+    // Handle replies to pushed events
+    if (msg.event === 'phx_reply') {
+      const payload = typeof msg.payload === 'string' ? JSON.parse(msg.payload) : msg.payload;
+      const replyHandler = msg.ref ? this.replyHandlers.get(msg.ref) : undefined;
+      if (replyHandler) {
+        this.replyHandlers.delete(msg.ref);
+        if (payload.status === 'ok') {
+          replyHandler.ok(payload.response);
+          return;
+        }
+        if (replyHandler.error) {
+          replyHandler.error(payload.response);
+          return;
+        }
+      }
+      if (payload.status === 'error') {
+        this.handleError(payload.response?.reason, 'reply');
+        return;
+      }
+    }
+
+    // Handle server-side crash of the channel
+    if (msg.event === 'phx_error') {
+      const payload = typeof msg.payload === 'string' ? JSON.parse(msg.payload) : msg.payload;
+      this.handleError(payload?.reason, 'crash');
+      return;
+    }
+
+    // Handle server-initiated URL change
+    if (msg.event === 'live_patch') {
+      const payload = typeof msg.payload === 'string' ? JSON.parse(msg.payload) : msg.payload;
+      const url = new URL(payload.url, window.location.href).toString();
+      if (payload.kind === 'replace') {
+        history.replaceState({ phx: this.topic }, '', url);
+      } else {
+        history.pushState({ phx: this.topic }, '', url);
+      }
+      this.trigger('patch', payload);
+      return;
+    }
+
+    // Handle server-initiated navigation to another LiveView
+    if (msg.event === 'live_redirect') {
+      const payload = typeof msg.payload === 'string' ? JSON.parse(msg.payload) : msg.payload;
+      const url = new URL(payload.url, window.location.href).toString();
+      // A redirect to a regular page carries the flash in a cookie
+      if (payload.kind === 'redirect') {
+        if (payload.flash) {
+          document.cookie = `${FLASH_COOKIE}=${payload.flash}; path=/; max-age=60; SameSite=Lax`;
+        }
+        window.location.href = url;
+        return;
+      }
+      if (payload.kind === 'replace') {
+        history.replaceState({ phx: payload.topic }, '', url);
+      } else {
+        history.pushState({ phx: payload.topic }, '', url);
       }
+      this.switchTopic(payload.topic, payload.session);
       return;
     }
 
@@ -181,6 +440,57 @@ export class Channel {
     this.trigger(msg.event, payload);
   }
 
+  private handleError(reason: string | undefined, kind: ChannelError['kind']): void {
+    const error: ChannelError = { reason: reason || 'unknown', kind };
+
+    // A failed event only invalidates the channel when it was stale
+    if (kind === 'reply' && error.reason !== 'stale') {
+      this.trigger('error', error);
+      return;
+    }
+
+    this.state = 'errored';
+    this.trigger('error', error);
+    this.scheduleRejoin(error.reason);
+  }
+
+  private scheduleRejoin(reason: string): void {
+    if (fatalReasons.includes(reason)) {
+      return;
+    }
+    // The page's session token expired or no longer verifies; reload to
+    // get a fresh one
+    if (reason === 'invalid_session') {
+      window.location.reload();
+      return;
+    }
+    // The server was deployed with new assets
+    if (reason === 'stale_static') {
+      setTimeout(() => window.location.reload(), Math.random() * STALE_STATIC_RELOAD_JITTER_MS);
+      return;
+    }
+    if (this.rejoinTries >= this.socket.maxRejoinAttempts) {
+      console.error(`Giving up rejoining ${this.topic} after ${this.rejoinTries} attempts`);
+      return;
+    }
+
+    this.rejoinTries++;
+    this.clearRejoinTimer();
+    this.rejoinTimer = setTimeout(() => {
+      this.rejoinTimer = null;
+      if (this.state === 'errored') {
+        this.rejoin();
+      }
+    }, this.socket.rejoinAfterMs(this.rejoinTries));
+  }
+
+  private clearRejoinTimer(): void {
+    if (this.rejoinTimer) {
+      clearTimeout(this.rejoinTimer);
+      this.rejoinTimer = null;
+    }
+  }
+
   private trigger(event: string, payload: any): void {
     const handlers = this.bindings.get(event);
     if (handlers) {
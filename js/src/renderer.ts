@@ -4,12 +4,29 @@ import morphdom from 'morphdom';
 export interface Patch {
   s?: string[];           // Static parts
   d: (string | Patch | Patch[])[];  // Dynamic parts
+  a?: boolean;            // Append d to an append-only part
+  stream?: StreamOps;     // Operations on a stream; d holds the inserted rows
+}
+
+// StreamOps - Inserts, deletes and resets of a stream since the last render
+export interface StreamOps {
+  name: string;
+  inserts?: { id: string; at: number }[];
+  deletes?: string[];
+  reset?: boolean;
+}
+
+// StreamState - The rows of a stream, which only the client keeps
+interface StreamState {
+  stream: string;
+  rows: { id: string; html: string }[];
 }
 
 // Renderer - Applies patches to the DOM
 export class Renderer {
   private container: HTMLElement;
   private static: string[] | null = null;
+  private dynamic: any[] = [];
 
   constructor(container: HTMLElement) {
     this.container = container;
@@ -17,9 +34,20 @@ export class Renderer {
 
   // Apply a patch to the DOM
   apply(patch: Patch): void {
-    // Update static template if provided
+    // A patch with statics is a full render; otherwise null parts are
+    // unchanged and keep their previous value. A full render of the same
+    // template, as after a rejoin, keeps what append-only parts had.
     if (patch.s) {
+      const prev = this.static && this.sameStatic(this.static, patch.s) ? this.dynamic : [];
       this.static = patch.s;
+      this.dynamic = patch.d.map((value: any, i: number) => {
+        if (value && value.stream) {
+          return this.applyStream(this.findStream(value.stream.name), value);
+        }
+        return value && value.a ? this.merge(prev[i], value) : value;
+      });
+    } else {
+      this.dynamic = this.mergeList(this.dynamic, patch.d);
     }
 
     if (!this.static) {
@@ -27,7 +55,7 @@ export class Renderer {
     }
 
     // Build HTML from static and dynamic parts
-    const html = this.build(this.static, patch.d);
+    const html = this.build(this.static, this.dynamic);
 
     // Apply using morphdom for efficient DOM updates
     morphdom(this.container, `<div>${html}</div>`, {
@@ -42,6 +70,82 @@ export class Renderer {
     });
   }
 
+  private sameStatic(a: string[], b: string[]): boolean {
+    return a.length === b.length && a.every((s, i) => s === b[i]);
+  }
+
+  private mergeList(prev: any[], next: any[]): any[] {
+    return next.map((value, i) => this.merge(prev[i], value));
+  }
+
+  // Merge a dynamic part of a diff into its previous value. Nested renders
+  // whose statics did not change arrive as their dynamic diff only, and
+  // append-only parts as the items to add.
+  private merge(prev: any, next: any): any {
+    if (next === null || next === undefined) {
+      return prev;
+    }
+    if (typeof next === 'object' && next.stream) {
+      return this.applyStream(prev, next);
+    }
+    if (typeof next === 'object' && next.a && Array.isArray(next.d)) {
+      return (typeof prev === 'string' ? prev : '') + next.d.join('');
+    }
+    if (Array.isArray(next)) {
+      if (prev && prev.s && Array.isArray(prev.d)) {
+        return { s: prev.s, d: this.mergeList(prev.d, next) };
+      }
+      return Array.isArray(prev) ? this.mergeList(prev, next) : next;
+    }
+    if (typeof next === 'object' && !next.s && Array.isArray(next.d) && prev && prev.s) {
+      return { s: prev.s, d: this.mergeList(prev.d, next.d) };
+    }
+    return next;
+  }
+
+  // Find the rows of a stream among the current parts, so a full render
+  // keeps the rows the server no longer has
+  private findStream(name: string): StreamState | undefined {
+    return this.dynamic.find((value: any) => value && value.stream === name && Array.isArray(value.rows));
+  }
+
+  // Apply stream operations: reset, then deletes, then inserts. Inserted
+  // rows are the elements of the patch's HTML, matched by id.
+  private applyStream(prev: any, patch: Patch): StreamState {
+    const ops = patch.stream!;
+    let rows: StreamState['rows'] =
+      !ops.reset && prev && Array.isArray(prev.rows) ? prev.rows.slice() : [];
+
+    const deletes = new Set(ops.deletes || []);
+    rows = rows.filter(row => !deletes.has(row.id));
+
+    const template = document.createElement('template');
+    template.innerHTML = patch.d.join('');
+    const inserted = new Map<string, string>();
+    Array.from(template.content.children).forEach(el => {
+      if (el.id) {
+        inserted.set(el.id, el.outerHTML);
+      }
+    });
+
+    for (const { id, at } of ops.inserts || []) {
+      const html = inserted.get(id);
+      if (html === undefined) {
+        continue;
+      }
+      const existing = rows.findIndex(row => row.id === id);
+      if (existing >= 0) {
+        rows[existing] = { id, html };
+      } else if (at < 0 || at >= rows.length) {
+        rows.push({ id, html });
+      } else {
+        rows.splice(at, 0, { id, html });
+      }
+    }
+
+    return { stream: ops.name, rows };
+  }
+
   // Build HTML string from static and dynamic parts
   private build(staticParts: string[], dynamicParts: any[]): string {
     let result = '';
@@ -63,8 +167,10 @@ export class Renderer {
       return '';
     }
 
+    // Parts are cut from the rendered HTML and inserted as is; the server
+    // must escape them, which templ does
     if (typeof value === 'string') {
-      return this.escapeHtml(value);
+      return value;
     }
 
     if (typeof value === 'number' || typeof value === 'boolean') {
@@ -75,6 +181,11 @@ export class Renderer {
       return value.map(v => this.renderDynamic(v)).join('');
     }
 
+    if (Array.isArray(value.rows)) {
+      // Stream rows
+      return value.rows.map((row: { html: string }) => row.html).join('');
+    }
+
     if (value.s && value.d) {
       // Nested patch
       return this.build(value.s, value.d);
@@ -82,13 +193,6 @@ export class Renderer {
 
     return '';
   }
-
-  // Escape HTML entities
-  private escapeHtml(text: string): string {
-    const div = document.createElement('div');
-    div.textContent = text;
-    return div.innerHTML;
-  }
 }
 
 // LiveViewRenderer - High-level LiveView rendering
@@ -109,10 +213,22 @@ export class LiveViewRenderer {
     this.renderer.apply(patch);
   }
 
-  // Set up event delegation for LiveView events
-  setupEventDelegation(pushEvent: (event: string, payload: any) => void): void {
+  // Set up event delegation for LiveView events. Links marked with
+  // data-phx-link are passed to onLink instead of being followed.
+  setupEventDelegation(
+    pushEvent: (event: string, payload: any) => void,
+    onLink?: (href: string, kind: string) => void
+  ): void {
     this.container.addEventListener('click', (e) => {
       const target = e.target as HTMLElement;
+
+      const phxLink = target.closest('a[data-phx-link]') as HTMLAnchorElement | null;
+      if (phxLink && onLink) {
+        e.preventDefault();
+        onLink(phxLink.href, phxLink.getAttribute('data-phx-link')!);
+        return;
+      }
+
       const phxClick = target.closest('[phx-click]');
       
       if (phxClick) {
@@ -2,17 +2,24 @@ package liveview_test
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/a-h/templ"
 	"github.com/fu2hito/go-liveview"
+	lvsession "github.com/fu2hito/go-liveview/internal/session"
 	"github.com/fu2hito/go-liveview/internal/socket"
 	"github.com/gorilla/websocket"
 )
@@ -232,3 +239,2261 @@ func TestBroadcaster(t *testing.T) {
 		t.Error("Timeout waiting for broadcast")
 	}
 }
+
+// dialTest starts an httptest server for handler and opens a WebSocket to it
+func dialTest(t *testing.T, handler http.Handler) (*websocket.Conn, string) {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/"
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect to WebSocket: %v", err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws, wsURL
+}
+
+// joinTopic joins topic with join ref "1" and returns the reply. A nil
+// payload joins with empty params.
+func joinTopic(t *testing.T, ws *websocket.Conn, topic string, payload map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	return joinTopicRef(t, ws, topic, "1", payload)
+}
+
+// joinTopicRef is joinTopic with the given join ref, for rejoins and
+// several channels on one connection
+func joinTopicRef(t *testing.T, ws *websocket.Conn, topic, ref string, payload map[string]interface{}) map[string]interface{} {
+	t.Helper()
+
+	if payload == nil {
+		payload = map[string]interface{}{"params": map[string]interface{}{}}
+	}
+	err := ws.WriteJSON(map[string]interface{}{
+		"join_ref": ref,
+		"ref":      ref,
+		"topic":    topic,
+		"event":    "phx_join",
+		"payload":  payload,
+	})
+	if err != nil {
+		t.Fatalf("Failed to send join message: %v", err)
+	}
+	return readMessage(t, ws)
+}
+
+// readMessage reads the next message, failing the test after a timeout
+func readMessage(t *testing.T, ws *websocket.Conn) map[string]interface{} {
+	t.Helper()
+
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg map[string]interface{}
+	if err := ws.ReadJSON(&msg); err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	return msg
+}
+
+func TestEventsProcessedInOrder(t *testing.T) {
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	manager.Register("test", func() liveview.LiveView {
+		return &TestLiveView{}
+	})
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{})
+
+	ws, _ := dialTest(t, handler)
+
+	err := ws.WriteJSON(map[string]interface{}{
+		"join_ref": "1",
+		"ref":      "1",
+		"topic":    "test",
+		"event":    "phx_join",
+		"payload":  map[string]interface{}{"params": map[string]interface{}{}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to send join message: %v", err)
+	}
+
+	const n = 20
+	for i := 0; i < n; i++ {
+		err := ws.WriteJSON(map[string]interface{}{
+			"topic": "test",
+			"event": "event",
+			"payload": map[string]interface{}{
+				"type":  "click",
+				"event": "inc",
+				"value": map[string]interface{}{},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to send event: %v", err)
+		}
+	}
+
+	if msg := readMessage(t, ws); msg["event"] != "phx_reply" {
+		t.Fatalf("Expected phx_reply, got %v", msg["event"])
+	}
+
+	for i := 1; i <= n; i++ {
+		msg := readMessage(t, ws)
+		if msg["event"] != "diff" {
+			t.Fatalf("Expected diff, got %v", msg["event"])
+		}
+		payload := msg["payload"].(map[string]interface{})
+		dynamic := payload["d"].([]interface{})
+		if got := dynamic[0]; got != strconv.Itoa(i) {
+			t.Fatalf("Diff %d: expected count %d, got %v", i, i, got)
+		}
+	}
+}
+
+// InfoLiveView counts messages delivered through HandleInfo
+type InfoLiveView struct {
+	TestLiveView
+}
+
+func (v *InfoLiveView) Mount(ctx *liveview.Context, params url.Values) error {
+	if err := ctx.Subscribe("test:room"); err != nil {
+		return err
+	}
+	return v.TestLiveView.Mount(ctx, params)
+}
+
+func (v *InfoLiveView) HandleInfo(ctx *liveview.Context, msg interface{}) error {
+	if bm, ok := msg.(liveview.BroadcastMessage); ok && bm.Event == "inc" {
+		v.count++
+		ctx.Assign("count", v.count)
+	}
+	return nil
+}
+
+func TestHandleInfoFromBroadcast(t *testing.T) {
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	broadcaster := liveview.NewBroadcaster(liveview.NewLocalPubSub())
+	manager.SetBroadcaster(broadcaster)
+	manager.Register("test", func() liveview.LiveView {
+		return &InfoLiveView{}
+	})
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{})
+
+	ws, _ := dialTest(t, handler)
+
+	if msg := joinTopic(t, ws, "test", nil); msg["event"] != "phx_reply" {
+		t.Fatalf("Expected phx_reply, got %v", msg["event"])
+	}
+
+	if err := broadcaster.Broadcast("test:room", "inc", nil); err != nil {
+		t.Fatalf("Failed to broadcast: %v", err)
+	}
+
+	msg := readMessage(t, ws)
+	if msg["event"] != "diff" {
+		t.Fatalf("Expected diff, got %v", msg["event"])
+	}
+	dynamic := msg["payload"].(map[string]interface{})["d"].([]interface{})
+	if dynamic[0] != "1" {
+		t.Errorf("Expected count 1, got %v", dynamic[0])
+	}
+}
+
+// DirectLiveView reports its session ID and counts messages sent to it
+// with Manager.SendTo
+type DirectLiveView struct {
+	TestLiveView
+	ids chan string
+}
+
+func (v *DirectLiveView) Mount(ctx *liveview.Context, params url.Values) error {
+	v.ids <- ctx.ID
+	return v.TestLiveView.Mount(ctx, params)
+}
+
+func (v *DirectLiveView) HandleInfo(ctx *liveview.Context, msg interface{}) error {
+	if msg == "inc" {
+		v.count++
+		ctx.Assign("count", v.count)
+	}
+	return nil
+}
+
+func TestSendTo(t *testing.T) {
+	ids := make(chan string, 1)
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	manager.Register("test", func() liveview.LiveView {
+		return &DirectLiveView{ids: ids}
+	})
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{})
+
+	if manager.SendTo("unknown", "inc") {
+		t.Error("Expected SendTo to an unknown session to return false")
+	}
+
+	ws, _ := dialTest(t, handler)
+	if msg := joinTopic(t, ws, "test", nil); msg["event"] != "phx_reply" {
+		t.Fatalf("Expected phx_reply, got %v", msg["event"])
+	}
+	id := <-ids
+
+	if !manager.SendTo(id, "inc") {
+		t.Fatal("Expected SendTo to a live session to return true")
+	}
+	msg := readMessage(t, ws)
+	if msg["event"] != "diff" {
+		t.Fatalf("Expected diff, got %v", msg["event"])
+	}
+	if d := msg["payload"].(map[string]interface{})["d"].([]interface{}); d[0] != "1" {
+		t.Errorf("Expected count 1, got %v", d[0])
+	}
+
+	err := ws.WriteJSON(map[string]interface{}{
+		"ref":     "2",
+		"topic":   "test",
+		"event":   "phx_leave",
+		"payload": map[string]interface{}{},
+	})
+	if err != nil {
+		t.Fatalf("Failed to send leave message: %v", err)
+	}
+
+	// The session is terminated on its own loop after the leave
+	deadline := time.Now().Add(time.Second)
+	for manager.SendTo(id, "inc") {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected SendTo to a terminated session to return false")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSendToRejoinedSession(t *testing.T) {
+	ids := make(chan string, 1)
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	manager.Register("test", func() liveview.LiveView {
+		return &DirectLiveView{ids: ids}
+	})
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{})
+
+	// Both joins use join ref "1", so both sessions get the same ID
+	ws, _ := dialTest(t, handler)
+	joinTopic(t, ws, "test", nil)
+	first := <-ids
+	joinTopic(t, ws, "test", nil)
+	if id := <-ids; id != first {
+		t.Fatalf("Expected the rejoin to reuse session ID %s, got %s", first, id)
+	}
+
+	// Terminating the replaced session must not unregister the new one
+	time.Sleep(100 * time.Millisecond)
+	if !manager.SendTo(first, "inc") {
+		t.Fatal("Expected SendTo to reach the rejoined session")
+	}
+	if msg := readMessage(t, ws); msg["event"] != "diff" {
+		t.Errorf("Expected diff, got %v", msg["event"])
+	}
+}
+
+// TickerLiveView increments its count on every tick
+type TickerLiveView struct {
+	TestLiveView
+}
+
+func (v *TickerLiveView) Mount(ctx *liveview.Context, params url.Values) error {
+	ctx.Every(10*time.Millisecond, "tick")
+	return v.TestLiveView.Mount(ctx, params)
+}
+
+func (v *TickerLiveView) HandleInfo(ctx *liveview.Context, msg interface{}) error {
+	if msg == "tick" {
+		v.count++
+		ctx.Assign("count", v.count)
+	}
+	return nil
+}
+
+func TestEveryStopsOnLeave(t *testing.T) {
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	manager.Register("test", func() liveview.LiveView {
+		return &TickerLiveView{}
+	})
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{})
+
+	ws, _ := dialTest(t, handler)
+
+	if msg := joinTopic(t, ws, "test", nil); msg["event"] != "phx_reply" {
+		t.Fatalf("Expected phx_reply, got %v", msg["event"])
+	}
+
+	for i := 0; i < 2; i++ {
+		if msg := readMessage(t, ws); msg["event"] != "diff" {
+			t.Fatalf("Expected diff, got %v", msg["event"])
+		}
+	}
+
+	err := ws.WriteJSON(map[string]interface{}{
+		"ref":     "2",
+		"topic":   "test",
+		"event":   "phx_leave",
+		"payload": map[string]interface{}{},
+	})
+	if err != nil {
+		t.Fatalf("Failed to send leave message: %v", err)
+	}
+
+	// Drain diffs that were already in flight, then expect silence
+	for end := time.Now().Add(time.Second); time.Now().Before(end); {
+		ws.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		var msg map[string]interface{}
+		if err := ws.ReadJSON(&msg); err != nil {
+			return
+		}
+	}
+	t.Fatal("Timer kept delivering after leave")
+}
+
+func TestEveryNonPositiveInterval(t *testing.T) {
+	ctx := liveview.NewContext(context.Background(), nil, "test")
+	for _, interval := range []time.Duration{0, -time.Second} {
+		cancel := ctx.Every(interval, "tick")
+		cancel()
+	}
+}
+
+// DelayLiveView increments its count when a SendAfter message arrives
+type DelayLiveView struct {
+	TestLiveView
+	delay     time.Duration
+	cancel    context.CancelFunc
+	delivered atomic.Int32
+}
+
+func (v *DelayLiveView) Mount(ctx *liveview.Context, params url.Values) error {
+	v.cancel = ctx.SendAfter(v.delay, "ping")
+	return v.TestLiveView.Mount(ctx, params)
+}
+
+func (v *DelayLiveView) HandleEvent(ctx *liveview.Context, event string, payload map[string]interface{}) error {
+	if event == "cancel" {
+		v.cancel()
+	}
+	return nil
+}
+
+func (v *DelayLiveView) HandleInfo(ctx *liveview.Context, msg interface{}) error {
+	if msg == "ping" {
+		v.delivered.Add(1)
+		v.count++
+		ctx.Assign("count", v.count)
+	}
+	return nil
+}
+
+// joinDelay joins a DelayLiveView waiting delay before its message
+func joinDelay(t *testing.T, delay time.Duration) (*websocket.Conn, *DelayLiveView) {
+	t.Helper()
+
+	view := &DelayLiveView{delay: delay}
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	manager.Register("test", func() liveview.LiveView { return view })
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{})
+
+	ws, _ := dialTest(t, handler)
+	if msg := joinTopic(t, ws, "test", nil); msg["event"] != "phx_reply" {
+		t.Fatalf("Expected phx_reply, got %v", msg["event"])
+	}
+	return ws, view
+}
+
+func TestSendAfter(t *testing.T) {
+	ws, _ := joinDelay(t, 20*time.Millisecond)
+
+	msg := readMessage(t, ws)
+	if msg["event"] != "diff" {
+		t.Fatalf("Expected diff, got %v", msg["event"])
+	}
+	if d := msg["payload"].(map[string]interface{})["d"].([]interface{}); d[0] != "1" {
+		t.Errorf("Expected count 1 after SendAfter, got %v", d[0])
+	}
+}
+
+func TestSendAfterStops(t *testing.T) {
+	stops := map[string]map[string]interface{}{
+		"Cancel": {
+			"join_ref": "1",
+			"topic":    "test",
+			"event":    "event",
+			"payload":  map[string]interface{}{"type": "click", "event": "cancel", "value": map[string]interface{}{}},
+		},
+		"Leave": {
+			"ref":     "2",
+			"topic":   "test",
+			"event":   "phx_leave",
+			"payload": map[string]interface{}{},
+		},
+	}
+	for name, stop := range stops {
+		t.Run(name, func(t *testing.T) {
+			ws, view := joinDelay(t, 200*time.Millisecond)
+			if err := ws.WriteJSON(stop); err != nil {
+				t.Fatalf("Failed to send %s: %v", stop["event"], err)
+			}
+
+			time.Sleep(400 * time.Millisecond)
+			if n := view.delivered.Load(); n != 0 {
+				t.Errorf("Expected no delivery after %s, got %d", name, n)
+			}
+		})
+	}
+}
+
+// TerminateLiveView reports the reason it was terminated with
+type TerminateLiveView struct {
+	TestLiveView
+	reasons chan liveview.TerminateReason
+}
+
+func (v *TerminateLiveView) Terminate(ctx *liveview.Context, reason liveview.TerminateReason) {
+	v.reasons <- reason
+}
+
+func TestTerminateReasons(t *testing.T) {
+	reasons := make(chan liveview.TerminateReason, 2)
+
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	manager.Register("test", func() liveview.LiveView {
+		return &TerminateLiveView{reasons: reasons}
+	})
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{})
+
+	expect := func(want liveview.TerminateReason) {
+		t.Helper()
+		select {
+		case got := <-reasons:
+			if got != want {
+				t.Errorf("Expected reason %v, got %v", want, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timeout waiting for Terminate(%v)", want)
+		}
+	}
+
+	t.Run("Leave", func(t *testing.T) {
+		ws, _ := dialTest(t, handler)
+		joinTopic(t, ws, "test", nil)
+
+		err := ws.WriteJSON(map[string]interface{}{
+			"ref":     "2",
+			"topic":   "test",
+			"event":   "phx_leave",
+			"payload": map[string]interface{}{},
+		})
+		if err != nil {
+			t.Fatalf("Failed to send leave message: %v", err)
+		}
+		expect(liveview.TerminateLeave)
+	})
+
+	t.Run("Disconnect", func(t *testing.T) {
+		ws, _ := dialTest(t, handler)
+		joinTopic(t, ws, "test", nil)
+
+		ws.Close()
+		expect(liveview.TerminateDisconnect)
+	})
+}
+
+// BadParamsLiveView mounts but rejects its params
+type BadParamsLiveView struct {
+	TerminateLiveView
+}
+
+func (v *BadParamsLiveView) HandleParams(ctx *liveview.Context, params url.Values) error {
+	return liveview.ErrNotFound
+}
+
+func TestTerminateOnRejectedParams(t *testing.T) {
+	reasons := make(chan liveview.TerminateReason, 1)
+
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	manager.Register("test", func() liveview.LiveView {
+		return &BadParamsLiveView{TerminateLiveView{reasons: reasons}}
+	})
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{})
+
+	ws, _ := dialTest(t, handler)
+	if reason := errorReason(t, joinTopic(t, ws, "test", nil)); reason != "not_found" {
+		t.Errorf("Expected not_found, got %q", reason)
+	}
+
+	select {
+	case got := <-reasons:
+		if got != liveview.TerminateCrash {
+			t.Errorf("Expected reason %v, got %v", liveview.TerminateCrash, got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for Terminate after rejected params")
+	}
+}
+
+func TestMultipleTopicsOnOneConnection(t *testing.T) {
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	for _, topic := range []string{"header", "main"} {
+		manager.Register(topic, func() liveview.LiveView {
+			return &TestLiveView{}
+		})
+	}
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{})
+
+	ws, _ := dialTest(t, handler)
+
+	for i, topic := range []string{"header", "main"} {
+		ref := strconv.Itoa(i + 1)
+		msg := joinTopicRef(t, ws, topic, ref, nil)
+		if msg["event"] != "phx_reply" || msg["topic"] != topic {
+			t.Fatalf("Expected phx_reply for %s, got %v on %v", topic, msg["event"], msg["topic"])
+		}
+	}
+
+	// Two events on main, one on header: each channel keeps its own count
+	for _, topic := range []string{"main", "main", "header"} {
+		err := ws.WriteJSON(map[string]interface{}{
+			"topic": topic,
+			"event": "event",
+			"payload": map[string]interface{}{
+				"type":  "click",
+				"event": "inc",
+				"value": map[string]interface{}{},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to send event: %v", err)
+		}
+	}
+
+	// Channels run independently, so only the order within a topic is fixed
+	got := map[string][]interface{}{}
+	for i := 0; i < 3; i++ {
+		msg := readMessage(t, ws)
+		if msg["event"] != "diff" {
+			t.Fatalf("Expected diff, got %v", msg["event"])
+		}
+		topic := msg["topic"].(string)
+		dynamic := msg["payload"].(map[string]interface{})["d"].([]interface{})
+		got[topic] = append(got[topic], dynamic[0])
+	}
+	if len(got["main"]) != 2 || got["main"][0] != "1" || got["main"][1] != "2" {
+		t.Errorf("main: expected counts [1 2], got %v", got["main"])
+	}
+	if len(got["header"]) != 1 || got["header"][0] != "1" {
+		t.Errorf("header: expected counts [1], got %v", got["header"])
+	}
+
+	// Events carrying a stale join_ref are rejected
+	err := ws.WriteJSON(map[string]interface{}{
+		"join_ref": "stale",
+		"ref":      "9",
+		"topic":    "main",
+		"event":    "event",
+		"payload": map[string]interface{}{
+			"type":  "click",
+			"event": "inc",
+			"value": map[string]interface{}{},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to send event: %v", err)
+	}
+	if reason := errorReason(t, readMessage(t, ws)); reason != "stale" {
+		t.Errorf("Expected stale reason, got %q", reason)
+	}
+}
+
+// errorReason extracts the reason from an error phx_reply
+func errorReason(t *testing.T, msg map[string]interface{}) string {
+	t.Helper()
+
+	if msg["event"] != "phx_reply" {
+		t.Fatalf("Expected phx_reply, got %v", msg["event"])
+	}
+	payload := msg["payload"].(map[string]interface{})
+	if payload["status"] != "error" {
+		t.Fatalf("Expected error status, got %v", payload["status"])
+	}
+	reason, _ := payload["response"].(map[string]interface{})["reason"].(string)
+	return reason
+}
+
+// FailingLiveView rejects joins and fails on every event
+type FailingLiveView struct {
+	TestLiveView
+}
+
+func (v *FailingLiveView) Mount(ctx *liveview.Context, params url.Values) error {
+	if params.Get("token") != "secret" {
+		return fmt.Errorf("mount: %w", liveview.ErrUnauthorized)
+	}
+	return v.TestLiveView.Mount(ctx, params)
+}
+
+func (v *FailingLiveView) HandleEvent(ctx *liveview.Context, event string, payload map[string]interface{}) error {
+	return fmt.Errorf("boom")
+}
+
+func TestErrorReplies(t *testing.T) {
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	manager.Register("test", func() liveview.LiveView {
+		return &FailingLiveView{}
+	})
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{})
+
+	join := func(ws *websocket.Conn, topic, token string) map[string]interface{} {
+		t.Helper()
+		return joinTopic(t, ws, topic, map[string]interface{}{
+			"params": map[string]interface{}{"token": token},
+		})
+	}
+
+	t.Run("NotFound", func(t *testing.T) {
+		ws, _ := dialTest(t, handler)
+		if reason := errorReason(t, join(ws, "missing", "secret")); reason != "not_found" {
+			t.Errorf("Expected not_found, got %q", reason)
+		}
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		ws, _ := dialTest(t, handler)
+		if reason := errorReason(t, join(ws, "test", "wrong")); reason != "unauthorized" {
+			t.Errorf("Expected unauthorized, got %q", reason)
+		}
+	})
+
+	t.Run("EventFailed", func(t *testing.T) {
+		ws, _ := dialTest(t, handler)
+		join(ws, "test", "secret")
+
+		err := ws.WriteJSON(map[string]interface{}{
+			"topic": "test",
+			"event": "event",
+			"payload": map[string]interface{}{
+				"type":  "click",
+				"event": "inc",
+				"value": map[string]interface{}{},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to send event: %v", err)
+		}
+
+		msg := readMessage(t, ws)
+		if msg["event"] != "phx_error" {
+			t.Fatalf("Expected phx_error, got %v", msg["event"])
+		}
+		if reason := msg["payload"].(map[string]interface{})["reason"]; reason != "event_failed" {
+			t.Errorf("Expected event_failed, got %v", reason)
+		}
+	})
+}
+
+// PanicLiveView panics when it receives the "boom" event
+type PanicLiveView struct {
+	TestLiveView
+}
+
+func (v *PanicLiveView) HandleEvent(ctx *liveview.Context, event string, payload map[string]interface{}) error {
+	if event == "boom" {
+		panic("boom")
+	}
+	return v.TestLiveView.HandleEvent(ctx, event, payload)
+}
+
+func TestCrashIsolation(t *testing.T) {
+	reports := make(chan liveview.CrashReport, 1)
+
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	manager.SetCrashReporter(liveview.CrashReporterFunc(func(report liveview.CrashReport) {
+		reports <- report
+	}))
+	manager.SetRestartPolicy(liveview.RestartPolicy{MaxRestarts: 2, Window: time.Minute})
+	for _, topic := range []string{"crashy", "other"} {
+		manager.Register(topic, func() liveview.LiveView {
+			return &PanicLiveView{}
+		})
+	}
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{})
+
+	ws, _ := dialTest(t, handler)
+
+	join := func(topic, ref string) map[string]interface{} {
+		t.Helper()
+		return joinTopicRef(t, ws, topic, ref, nil)
+	}
+	push := func(topic, event string) {
+		t.Helper()
+		err := ws.WriteJSON(map[string]interface{}{
+			"topic": topic,
+			"event": "event",
+			"payload": map[string]interface{}{
+				"type":  "click",
+				"event": event,
+				"value": map[string]interface{}{},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to send event: %v", err)
+		}
+	}
+
+	join("crashy", "1")
+	join("other", "2")
+	push("crashy", "boom")
+
+	msg := readMessage(t, ws)
+	if msg["event"] != "phx_error" || msg["topic"] != "crashy" {
+		t.Fatalf("Expected phx_error on crashy, got %v on %v", msg["event"], msg["topic"])
+	}
+
+	select {
+	case report := <-reports:
+		if report.LastEvent != "boom" || report.Topic != "crashy" || len(report.Stack) == 0 {
+			t.Errorf("Unexpected crash report: %+v", report)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for crash report")
+	}
+
+	// The other channel on the same connection keeps working
+	push("other", "inc")
+	msg = readMessage(t, ws)
+	if msg["event"] != "diff" || msg["topic"] != "other" {
+		t.Fatalf("Expected diff on other, got %v on %v", msg["event"], msg["topic"])
+	}
+
+	// The client may rejoin with a fresh mount after the crash
+	msg = join("crashy", "3")
+	if msg["event"] != "phx_reply" || msg["payload"].(map[string]interface{})["status"] != "ok" {
+		t.Fatalf("Expected successful rejoin, got %v", msg)
+	}
+
+	// The restart policy allows two crashes per minute
+	push("crashy", "boom")
+	if msg := readMessage(t, ws); msg["event"] != "phx_error" {
+		t.Fatalf("Expected phx_error, got %v", msg["event"])
+	}
+	<-reports
+	if reason := errorReason(t, join("crashy", "4")); reason != "too_many_restarts" {
+		t.Errorf("Expected too_many_restarts, got %q", reason)
+	}
+}
+
+// PageLiveView renders the page param it was last given
+type PageLiveView struct {
+	page string
+}
+
+func (v *PageLiveView) Mount(ctx *liveview.Context, params url.Values) error {
+	return nil
+}
+
+func (v *PageLiveView) HandleEvent(ctx *liveview.Context, event string, payload map[string]interface{}) error {
+	if event == "last" {
+		return ctx.PushPatch("/items?page=9")
+	}
+	return nil
+}
+
+func (v *PageLiveView) HandleParams(ctx *liveview.Context, params url.Values) error {
+	if params.Get("page") == "bad" {
+		return fmt.Errorf("bad page")
+	}
+	v.page = params.Get("page")
+	return nil
+}
+
+func (v *PageLiveView) Render(ctx *liveview.Context) templ.Component {
+	return templ.ComponentFunc(func(_ context.Context, w io.Writer) error {
+		_, err := io.WriteString(w, `<p>Page <!--$0-->`+v.page+`<!--/$0--></p>`)
+		return err
+	})
+}
+
+func TestLivePatch(t *testing.T) {
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	manager.Register("items", func() liveview.LiveView {
+		return &PageLiveView{}
+	})
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{})
+
+	ws, _ := dialTest(t, handler)
+
+	msg := joinTopic(t, ws, "items", map[string]interface{}{
+		"params": map[string]interface{}{},
+		"url":    "http://example.com/items?page=2",
+	})
+	rendered := msg["payload"].(map[string]interface{})["response"].(map[string]interface{})["rendered"].(map[string]interface{})
+	if d := rendered["d"].([]interface{}); d[0] != "2" {
+		t.Errorf("Expected page 2 after join, got %v", d[0])
+	}
+
+	// Client-driven patch replies with the diff
+	err := ws.WriteJSON(map[string]interface{}{
+		"join_ref": "1",
+		"ref":      "2",
+		"topic":    "items",
+		"event":    "live_patch",
+		"payload":  map[string]interface{}{"url": "http://example.com/items?page=3"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to send live_patch: %v", err)
+	}
+	msg = readMessage(t, ws)
+	if msg["event"] != "phx_reply" || msg["ref"] != "2" {
+		t.Fatalf("Expected phx_reply to live_patch, got %v", msg)
+	}
+	diff := msg["payload"].(map[string]interface{})["response"].(map[string]interface{})["diff"].(map[string]interface{})
+	if d := diff["d"].([]interface{}); d[0] != "3" {
+		t.Errorf("Expected page 3 after patch, got %v", d[0])
+	}
+
+	// Server-driven patch pushes the new URL, then the diff
+	err = ws.WriteJSON(map[string]interface{}{
+		"topic": "items",
+		"event": "event",
+		"payload": map[string]interface{}{
+			"type":  "click",
+			"event": "last",
+			"value": map[string]interface{}{},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to send event: %v", err)
+	}
+	if msg := readMessage(t, ws); msg["event"] != "diff" {
+		t.Fatalf("Expected diff for event, got %v", msg["event"])
+	}
+	msg = readMessage(t, ws)
+	if msg["event"] != "live_patch" {
+		t.Fatalf("Expected live_patch push, got %v", msg["event"])
+	}
+	if u := msg["payload"].(map[string]interface{})["url"]; u != "/items?page=9" {
+		t.Errorf("Expected patch to /items?page=9, got %v", u)
+	}
+	msg = readMessage(t, ws)
+	if d := msg["payload"].(map[string]interface{})["d"].([]interface{}); d[0] != "9" {
+		t.Errorf("Expected page 9 after push patch, got %v", d[0])
+	}
+
+	// A patch whose params fail is replied to before the channel errors
+	err = ws.WriteJSON(map[string]interface{}{
+		"join_ref": "1",
+		"ref":      "3",
+		"topic":    "items",
+		"event":    "live_patch",
+		"payload":  map[string]interface{}{"url": "http://example.com/items?page=bad"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to send live_patch: %v", err)
+	}
+	msg = readMessage(t, ws)
+	if reason := errorReason(t, msg); reason != "params_failed" || msg["ref"] != "3" {
+		t.Errorf("Expected params_failed reply to ref 3, got %q to %v", reason, msg["ref"])
+	}
+	if msg := readMessage(t, ws); msg["event"] != "phx_error" {
+		t.Errorf("Expected phx_error, got %v", msg["event"])
+	}
+}
+
+// NavLiveView navigates to the items LiveView on the "go" event
+type NavLiveView struct {
+	TestLiveView
+}
+
+func (v *NavLiveView) HandleEvent(ctx *liveview.Context, event string, payload map[string]interface{}) error {
+	if event == "go" {
+		return ctx.PushNavigate("/items?page=5")
+	}
+	return v.TestLiveView.HandleEvent(ctx, event, payload)
+}
+
+func TestLiveRedirect(t *testing.T) {
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	manager.Register("nav", func() liveview.LiveView {
+		return &NavLiveView{}
+	})
+	manager.Register("items", func() liveview.LiveView {
+		return &PageLiveView{}
+	})
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{})
+
+	ws, _ := dialTest(t, handler)
+
+	join := func(topic, ref, url string) map[string]interface{} {
+		t.Helper()
+		return joinTopicRef(t, ws, topic, ref, map[string]interface{}{
+			"params": map[string]interface{}{},
+			"url":    url,
+		})
+	}
+
+	join("items", "1", "http://example.com/items")
+
+	// Client-driven redirect resolves the path to a topic
+	err := ws.WriteJSON(map[string]interface{}{
+		"join_ref": "1",
+		"ref":      "2",
+		"topic":    "items",
+		"event":    "live_redirect",
+		"payload":  map[string]interface{}{"url": "http://example.com/nav"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to send live_redirect: %v", err)
+	}
+	msg := readMessage(t, ws)
+	response := msg["payload"].(map[string]interface{})["response"].(map[string]interface{})
+	if response["topic"] != "nav" {
+		t.Fatalf("Expected redirect to nav, got %v", msg)
+	}
+
+	// The old channel is gone
+	err = ws.WriteJSON(map[string]interface{}{
+		"ref":     "3",
+		"topic":   "items",
+		"event":   "live_patch",
+		"payload": map[string]interface{}{"url": "http://example.com/items?page=2"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to send live_patch: %v", err)
+	}
+	if reason := errorReason(t, readMessage(t, ws)); reason != "stale" {
+		t.Errorf("Expected stale after redirect, got %q", reason)
+	}
+
+	// Server-driven navigation pushes the target topic
+	join("nav", "4", "http://example.com/nav")
+	err = ws.WriteJSON(map[string]interface{}{
+		"topic": "nav",
+		"event": "event",
+		"payload": map[string]interface{}{
+			"type":  "click",
+			"event": "go",
+			"value": map[string]interface{}{},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to send event: %v", err)
+	}
+	readMessage(t, ws) // diff for the event
+	msg = readMessage(t, ws)
+	if msg["event"] != "live_redirect" {
+		t.Fatalf("Expected live_redirect push, got %v", msg["event"])
+	}
+	redirect := msg["payload"].(map[string]interface{})
+	if redirect["topic"] != "items" || redirect["url"] != "/items?page=5" {
+		t.Fatalf("Unexpected redirect payload: %v", redirect)
+	}
+
+	msg = join("items", "5", "http://example.com/items?page=5")
+	rendered := msg["payload"].(map[string]interface{})["response"].(map[string]interface{})["rendered"].(map[string]interface{})
+	if d := rendered["d"].([]interface{}); d[0] != "5" {
+		t.Errorf("Expected page 5 after navigation, got %v", d[0])
+	}
+}
+
+// UserLiveView renders the id path value and tab query param
+type UserLiveView struct {
+	id, tab string
+}
+
+func (v *UserLiveView) Mount(ctx *liveview.Context, params url.Values) error {
+	v.id = params.Get("id")
+	return nil
+}
+
+func (v *UserLiveView) HandleEvent(ctx *liveview.Context, event string, payload map[string]interface{}) error {
+	return nil
+}
+
+func (v *UserLiveView) HandleParams(ctx *liveview.Context, params url.Values) error {
+	v.tab = params.Get("tab")
+	return nil
+}
+
+func (v *UserLiveView) Render(ctx *liveview.Context) templ.Component {
+	return templ.ComponentFunc(func(_ context.Context, w io.Writer) error {
+		_, err := io.WriteString(w, `<p><!--$0-->`+v.id+`<!--/$0--> <!--$1-->`+v.tab+`<!--/$1--></p>`)
+		return err
+	})
+}
+
+func TestRouter(t *testing.T) {
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{
+		Template: `<div id="live-view-root" data-phx-topic="{{.Topic}}"></div>`,
+	})
+	router := liveview.NewRouter(manager, handler)
+	router.Live("/users/{id}/edit", func() liveview.LiveView {
+		return &UserLiveView{}
+	})
+	topic := liveview.RouteTopic("/users/{id}/edit")
+
+	t.Run("GET", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", "/users/7/edit", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rec.Code)
+		}
+		if body := rec.Body.String(); !strings.Contains(body, `data-phx-topic="`+topic+`"`) {
+			t.Errorf("Expected page to carry topic %s, got %s", topic, body)
+		}
+
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", "/users", nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404 for unknown path, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Join", func(t *testing.T) {
+		ws, _ := dialTest(t, router)
+		msg := joinTopic(t, ws, topic, map[string]interface{}{
+			"params": map[string]interface{}{},
+			"url":    "http://example.com/users/7/edit?tab=profile",
+		})
+		rendered := msg["payload"].(map[string]interface{})["response"].(map[string]interface{})["rendered"].(map[string]interface{})
+		d := rendered["d"].([]interface{})
+		if d[0] != "7" || d[1] != "profile" {
+			t.Errorf("Expected id 7 and tab profile, got %v", d)
+		}
+	})
+}
+
+func TestRouterPrecedence(t *testing.T) {
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{
+		Template: `{{.Topic}}`,
+	})
+	router := liveview.NewRouter(manager, handler)
+	router.Live("/users/{id}", func() liveview.LiveView {
+		return &UserLiveView{}
+	})
+	router.Live("/users/new", func() liveview.LiveView {
+		return &TestLiveView{}
+	})
+	want := liveview.RouteTopic("/users/new")
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/users/new", nil))
+	if topic := rec.Body.String(); topic != want {
+		t.Errorf("Expected page for %s, got %s", want, topic)
+	}
+
+	// Live redirects pick the same route as the page request
+	ws, _ := dialTest(t, router)
+	joinTopic(t, ws, liveview.RouteTopic("/users/{id}"), map[string]interface{}{
+		"params": map[string]interface{}{},
+		"url":    "http://example.com/users/7",
+	})
+	err := ws.WriteJSON(map[string]interface{}{
+		"join_ref": "1",
+		"ref":      "2",
+		"topic":    liveview.RouteTopic("/users/{id}"),
+		"event":    "live_redirect",
+		"payload":  map[string]interface{}{"url": "http://example.com/users/new"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to send live_redirect: %v", err)
+	}
+	msg := readMessage(t, ws)
+	response := msg["payload"].(map[string]interface{})["response"].(map[string]interface{})
+	if response["topic"] != want {
+		t.Errorf("Expected redirect to %s, got %v", want, response["topic"])
+	}
+}
+
+func TestStaticRender(t *testing.T) {
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{
+		Template: `<div id="live-view-root" data-phx-session="{{.Session}}">{{.Content}}</div>`,
+		Secret:   "test-secret",
+	})
+	router := liveview.NewRouter(manager, handler)
+	router.Live("/users/{id}/edit", func() liveview.LiveView {
+		return &UserLiveView{}
+	})
+	router.Live("/admin", func() liveview.LiveView {
+		return &FailingLiveView{}
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/users/7/edit?tab=profile", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `<p>7 profile</p>`) {
+		t.Errorf("Expected rendered LiveView in page, got %s", body)
+	}
+	if strings.Contains(body, `data-phx-session=""`) {
+		t.Errorf("Expected a session token in page, got %s", body)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/admin", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for unauthorized mount, got %d", rec.Code)
+	}
+}
+
+// ConnectedLiveView renders how it was mounted
+type ConnectedLiveView struct {
+	TestLiveView
+	state string
+}
+
+func (v *ConnectedLiveView) Mount(ctx *liveview.Context, params url.Values) error {
+	switch {
+	case !ctx.Connected():
+		v.state = "static"
+	case ctx.Reconnected():
+		v.state = "reconnected"
+	default:
+		v.state = "connected"
+	}
+	return nil
+}
+
+func (v *ConnectedLiveView) Render(ctx *liveview.Context) templ.Component {
+	return templ.ComponentFunc(func(_ context.Context, w io.Writer) error {
+		_, err := io.WriteString(w, `<p><!--$0-->`+v.state+`<!--/$0--></p>`)
+		return err
+	})
+}
+
+func TestConnectedMount(t *testing.T) {
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{
+		Template: `<div>{{.Content}}</div>`,
+	})
+	router := liveview.NewRouter(manager, handler)
+	router.Live("/state", func() liveview.LiveView {
+		return &ConnectedLiveView{}
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/state", nil))
+	if body := rec.Body.String(); !strings.Contains(body, "<p>static</p>") {
+		t.Errorf("Expected static mount in page, got %s", body)
+	}
+
+	ws, _ := dialTest(t, router)
+	for i, want := range []string{"connected", "reconnected"} {
+		ref := strconv.Itoa(i + 1)
+		msg := joinTopicRef(t, ws, liveview.RouteTopic("/state"), ref, map[string]interface{}{
+			"params": map[string]interface{}{"_mounts": i},
+			"url":    "http://example.com/state",
+		})
+		rendered := msg["payload"].(map[string]interface{})["response"].(map[string]interface{})["rendered"].(map[string]interface{})
+		if d := rendered["d"].([]interface{}); d[0] != want {
+			t.Errorf("Expected %s mount with _mounts=%d, got %v", want, i, d[0])
+		}
+	}
+}
+
+// SessionLiveView renders the user it was mounted for
+type SessionLiveView struct {
+	TestLiveView
+	user string
+}
+
+func (v *SessionLiveView) Mount(ctx *liveview.Context, params url.Values) error {
+	s := ctx.Session()
+	role, _ := s.Data["role"].(string)
+	v.user = s.UserID + "/" + role
+	return nil
+}
+
+func (v *SessionLiveView) Render(ctx *liveview.Context) templ.Component {
+	return templ.ComponentFunc(func(_ context.Context, w io.Writer) error {
+		_, err := io.WriteString(w, `<p><!--$0-->`+v.user+`<!--/$0--></p>`)
+		return err
+	})
+}
+
+func TestSessionToken(t *testing.T) {
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{
+		Template: `{{.Session}}`,
+		Secret:   "test-secret",
+		Session: func(r *http.Request) (liveview.Session, error) {
+			return liveview.Session{
+				UserID: "42",
+				Data:   map[string]interface{}{"role": "admin"},
+			}, nil
+		},
+	})
+	router := liveview.NewRouter(manager, handler)
+	router.Live("/me", func() liveview.LiveView {
+		return &SessionLiveView{}
+	})
+	router.Live("/other", func() liveview.LiveView {
+		return &SessionLiveView{}
+	})
+
+	page := func(path string) string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %s, got %d", path, rec.Code)
+		}
+		return rec.Body.String()
+	}
+	token := page("/me")
+
+	// Build an expired token signed with the same secret
+	signer := lvsession.NewManager("test-secret")
+	expired, _ := signer.Create("42", map[string]interface{}{"view": liveview.RouteTopic("/me")})
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	expired.Sign([]byte("test-secret"))
+	expiredToken, _ := signer.Encode(expired)
+
+	ws, _ := dialTest(t, router)
+	join := func(ref, token string) map[string]interface{} {
+		t.Helper()
+		return joinTopicRef(t, ws, liveview.RouteTopic("/me"), ref, map[string]interface{}{
+			"params":  map[string]interface{}{},
+			"session": token,
+			"url":     "http://example.com/me",
+		})
+	}
+
+	msg := join("1", token)
+	rendered := msg["payload"].(map[string]interface{})["response"].(map[string]interface{})["rendered"].(map[string]interface{})
+	if d := rendered["d"].([]interface{}); d[0] != "42/admin" {
+		t.Errorf("Expected session data in Mount, got %v", d[0])
+	}
+
+	tampered := []byte(token)
+	tampered[len(tampered)/2] ^= 1
+	for name, bad := range map[string]string{
+		"tampered":   string(tampered),
+		"expired":    expiredToken,
+		"other view": page("/other"),
+		"missing":    "",
+	} {
+		if reason := errorReason(t, join("2", bad)); reason != "invalid_session" {
+			t.Errorf("Expected invalid_session for %s token, got %q", name, reason)
+		}
+	}
+}
+
+func TestNewFromOptions(t *testing.T) {
+	for name, opts := range map[string]liveview.Options{
+		"missing secret":     {},
+		"unknown strategy":   {Secret: "s", ReconnectStrategy: 99},
+		"malformed template": {Secret: "s", Template: "{{.Content"},
+	} {
+		if _, err := liveview.New(opts); err == nil {
+			t.Errorf("Expected error for %s", name)
+		}
+	}
+
+	srv, err := liveview.New(liveview.Options{
+		Secret:   "test-secret",
+		Template: `<div data-phx-session="{{.Session}}">{{.Content}}</div>`,
+	})
+	if err != nil {
+		t.Fatalf("Failed to build server: %v", err)
+	}
+	if srv.Manager.GetBroadcaster() != srv.Broadcaster || srv.Broadcaster == nil {
+		t.Error("Expected the manager to use the server broadcaster")
+	}
+	srv.Live("/users/{id}/edit", func() liveview.LiveView {
+		return &UserLiveView{}
+	})
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest("GET", "/users/3/edit?tab=a", nil))
+	body := rec.Body.String()
+	if !strings.Contains(body, "<p>3 a</p>") {
+		t.Errorf("Expected rendered LiveView in page, got %s", body)
+	}
+	_, token, _ := strings.Cut(body, `data-phx-session="`)
+	token, _, _ = strings.Cut(token, `"`)
+
+	ws, _ := dialTest(t, srv)
+	msg := joinTopic(t, ws, liveview.RouteTopic("/users/{id}/edit"), map[string]interface{}{
+		"params":  map[string]interface{}{},
+		"session": token,
+		"url":     "http://example.com/users/3/edit",
+	})
+	if status := msg["payload"].(map[string]interface{})["status"]; status != "ok" {
+		t.Errorf("Expected ok join reply, got %v", msg)
+	}
+}
+
+func TestReconnectRestore(t *testing.T) {
+	reasons := make(chan liveview.TerminateReason, 1)
+
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	manager.SetReconnectStrategy(liveview.ReconnectRestore, 500*time.Millisecond)
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{
+		Template: `{{.Session}}`,
+		Secret:   "test-secret",
+	})
+	router := liveview.NewRouter(manager, handler)
+	router.Live("/count", func() liveview.LiveView {
+		return &TerminateLiveView{reasons: reasons}
+	})
+	topic := liveview.RouteTopic("/count")
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/count", nil))
+	token := rec.Body.String()
+
+	join := func(ws *websocket.Conn, mounts int) string {
+		t.Helper()
+		msg := joinTopic(t, ws, topic, map[string]interface{}{
+			"params":  map[string]interface{}{"_mounts": mounts},
+			"session": token,
+		})
+		rendered := msg["payload"].(map[string]interface{})["response"].(map[string]interface{})["rendered"].(map[string]interface{})
+		return rendered["d"].([]interface{})[0].(string)
+	}
+
+	ws, _ := dialTest(t, router)
+	join(ws, 0)
+	err := ws.WriteJSON(map[string]interface{}{
+		"join_ref": "1",
+		"topic":    topic,
+		"event":    "event",
+		"payload":  map[string]interface{}{"type": "click", "event": "inc", "value": map[string]interface{}{}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to send event: %v", err)
+	}
+	if msg := readMessage(t, ws); msg["event"] != "diff" {
+		t.Fatalf("Expected diff, got %v", msg["event"])
+	}
+	ws.Close()
+
+	// A rejoin within the grace period gets the same LiveView back
+	time.Sleep(100 * time.Millisecond)
+	ws, _ = dialTest(t, router)
+	if count := join(ws, 1); count != "1" {
+		t.Errorf("Expected restored count 1, got %s", count)
+	}
+	select {
+	case reason := <-reasons:
+		t.Fatalf("Expected no Terminate on restore, got %v", reason)
+	default:
+	}
+
+	// A socket closing right after its rejoin parks the session again
+	ws.Close()
+	time.Sleep(100 * time.Millisecond)
+	dropped, _ := dialTest(t, router)
+	err = dropped.WriteJSON(map[string]interface{}{
+		"join_ref": "1",
+		"ref":      "1",
+		"topic":    topic,
+		"event":    "phx_join",
+		"payload":  map[string]interface{}{"session": token},
+	})
+	if err != nil {
+		t.Fatalf("Failed to send join message: %v", err)
+	}
+	dropped.Close()
+	time.Sleep(100 * time.Millisecond)
+	ws, _ = dialTest(t, router)
+	if count := join(ws, 2); count != "1" {
+		t.Errorf("Expected restored count 1 after a dropped rejoin, got %s", count)
+	}
+
+	// Without a rejoin the session is terminated after the grace period
+	ws.Close()
+	select {
+	case reason := <-reasons:
+		if reason != liveview.TerminateDisconnect {
+			t.Errorf("Expected disconnect reason, got %v", reason)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for Terminate after grace period")
+	}
+}
+
+// SnapshotLiveView saves its count in snapshots
+type SnapshotLiveView struct {
+	TestLiveView
+}
+
+func (v *SnapshotLiveView) Snapshot() ([]byte, error) {
+	return []byte(strconv.Itoa(v.count)), nil
+}
+
+func (v *SnapshotLiveView) Restore(data []byte) error {
+	n, err := strconv.Atoi(string(data))
+	v.count = n
+	return err
+}
+
+func TestStateStoreRestoreOnOtherNode(t *testing.T) {
+	store, err := liveview.NewFileStateStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create state store: %v", err)
+	}
+
+	newNode := func() *liveview.Server {
+		srv, err := liveview.New(liveview.Options{
+			Secret:            "shared-secret",
+			Template:          `{{.Session}}`,
+			ReconnectStrategy: liveview.ReconnectRestore,
+			StateStore:        store,
+		})
+		if err != nil {
+			t.Fatalf("Failed to build server: %v", err)
+		}
+		srv.Live("/count", func() liveview.LiveView {
+			return &SnapshotLiveView{}
+		})
+		return srv
+	}
+	nodeA, nodeB := newNode(), newNode()
+	topic := liveview.RouteTopic("/count")
+
+	rec := httptest.NewRecorder()
+	nodeA.ServeHTTP(rec, httptest.NewRequest("GET", "/count", nil))
+	token := rec.Body.String()
+
+	join := func(ws *websocket.Conn) string {
+		t.Helper()
+		msg := joinTopic(t, ws, topic, map[string]interface{}{
+			"params":  map[string]interface{}{},
+			"session": token,
+		})
+		rendered := msg["payload"].(map[string]interface{})["response"].(map[string]interface{})["rendered"].(map[string]interface{})
+		return rendered["d"].([]interface{})[0].(string)
+	}
+
+	ws, _ := dialTest(t, nodeA)
+	join(ws)
+	for i := 0; i < 2; i++ {
+		err := ws.WriteJSON(map[string]interface{}{
+			"join_ref": "1",
+			"topic":    topic,
+			"event":    "event",
+			"payload":  map[string]interface{}{"type": "click", "event": "inc", "value": map[string]interface{}{}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to send event: %v", err)
+		}
+		readMessage(t, ws)
+	}
+	ws.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	// The reconnect lands on node B, which only has the stored snapshot
+	ws, _ = dialTest(t, nodeB)
+	if count := join(ws); count != "2" {
+		t.Errorf("Expected count 2 restored on other node, got %s", count)
+	}
+}
+
+func TestMemoryStateStoreExpiry(t *testing.T) {
+	store := liveview.NewMemoryStateStore()
+	if err := store.Save("k", []byte("v"), time.Millisecond); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := store.Load("k"); !errors.Is(err, liveview.ErrStateNotFound) {
+		t.Errorf("Expected ErrStateNotFound after ttl, got %v", err)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	reasons := make(chan liveview.TerminateReason, 1)
+
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	manager.Register("test", func() liveview.LiveView {
+		return &TerminateLiveView{reasons: reasons}
+	})
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{})
+
+	ws, wsURL := dialTest(t, handler)
+	joinTopic(t, ws, "test", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := manager.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	select {
+	case reason := <-reasons:
+		if reason != liveview.TerminateShutdown {
+			t.Errorf("Expected shutdown reason, got %v", reason)
+		}
+	default:
+		t.Error("Expected Terminate to have run before Shutdown returned")
+	}
+
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := ws.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseServiceRestart || closeErr.Text != socket.CloseReasonShutdown {
+		t.Errorf("Expected shutdown close frame, got %v", err)
+	}
+
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL, nil); err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected new connections to be refused after shutdown, got %v", err)
+	}
+}
+
+func TestShutdownAfterDisconnect(t *testing.T) {
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	manager.Register("test", func() liveview.LiveView {
+		return &TestLiveView{}
+	})
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{})
+
+	ws, _ := dialTest(t, handler)
+	ws.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := manager.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+}
+
+func TestTrackStatic(t *testing.T) {
+	asset := filepath.Join(t.TempDir(), "app.js")
+	if err := os.WriteFile(asset, []byte("console.log(1)"), 0o600); err != nil {
+		t.Fatalf("Failed to write asset: %v", err)
+	}
+
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	manager.Register("test", func() liveview.LiveView {
+		return &TestLiveView{}
+	})
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{
+		Template:    `{{.Static}}`,
+		TrackStatic: []string{asset},
+	})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	digest := rec.Body.String()
+	if digest == "" {
+		t.Fatal("Expected static digest in page")
+	}
+
+	ws, _ := dialTest(t, handler)
+	join := func(ref, static string) map[string]interface{} {
+		t.Helper()
+		return joinTopicRef(t, ws, "test", ref, map[string]interface{}{
+			"params": map[string]interface{}{},
+			"static": static,
+		})
+	}
+
+	if msg := join("1", digest); msg["payload"].(map[string]interface{})["status"] != "ok" {
+		t.Errorf("Expected join with current digest to succeed, got %v", msg)
+	}
+	if reason := errorReason(t, join("2", "outdated")); reason != "stale_static" {
+		t.Errorf("Expected stale_static for outdated digest, got %q", reason)
+	}
+
+	if _, err := liveview.New(liveview.Options{Secret: "s", TrackStatic: []string{asset + ".missing"}}); err == nil {
+		t.Error("Expected error for missing tracked asset")
+	}
+}
+
+func TestTypedKeys(t *testing.T) {
+	ctx := liveview.NewContext(context.Background(), nil, "")
+	count := liveview.Key[int]("count")
+
+	if got := count.GetOr(ctx, 5); got != 5 {
+		t.Errorf("Expected default 5 for missing key, got %d", got)
+	}
+	count.Set(ctx, 1)
+	count.Update(ctx, func(n int) int { return n + 1 })
+	if got := count.Get(ctx); got != 2 {
+		t.Errorf("Expected 2, got %d", got)
+	}
+	if !ctx.Changed["count"] {
+		t.Error("Expected Set to mark the key changed")
+	}
+
+	ctx.Assign("name", 42)
+	if got := liveview.GetOr(ctx, "name", "anon"); got != "anon" {
+		t.Errorf("Expected default for mistyped key, got %q", got)
+	}
+	if _, ok := liveview.Key[string]("name").Lookup(ctx); ok {
+		t.Error("Expected Lookup to report a mistyped key as unset")
+	}
+}
+
+// TrackedLiveView declares the assigns each part depends on
+type TrackedLiveView struct {
+	renders  atomic.Int32
+	stale    atomic.Bool
+	hitCount int
+}
+
+func (v *TrackedLiveView) Mount(ctx *liveview.Context, params url.Values) error {
+	ctx.Assign("count", 0)
+	ctx.Assign("label", "clicks")
+	return nil
+}
+
+func (v *TrackedLiveView) HandleEvent(ctx *liveview.Context, event string, payload map[string]interface{}) error {
+	// Changes from the previous cycle must not leak into this one
+	if ctx.IsChanged("count") {
+		v.stale.Store(true)
+	}
+	if event == "inc" {
+		liveview.Key[int]("count").Update(ctx, func(n int) int { return n + 1 })
+	}
+	// Not an assign, so the declared parts must not pick it up
+	v.hitCount++
+	return nil
+}
+
+func (v *TrackedLiveView) HandleParams(ctx *liveview.Context, params url.Values) error {
+	return nil
+}
+
+func (v *TrackedLiveView) Render(ctx *liveview.Context) templ.Component {
+	v.renders.Add(1)
+	count := liveview.Key[int]("count").Get(ctx)
+	label := liveview.Key[string]("label").Get(ctx)
+	hits := v.hitCount
+	return templ.ComponentFunc(func(_ context.Context, w io.Writer) error {
+		_, err := fmt.Fprintf(w, `<p><!--$0:count-->%d<!--/$0--> <!--$1:label-->%s %d<!--/$1--></p>`, count, label, hits)
+		return err
+	})
+}
+
+func TestChangeTracking(t *testing.T) {
+	view := &TrackedLiveView{}
+
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	manager.Register("tracked", func() liveview.LiveView {
+		return view
+	})
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{})
+
+	ws, _ := dialTest(t, handler)
+	joinTopic(t, ws, "tracked", nil)
+
+	send := func(event string) {
+		t.Helper()
+		err := ws.WriteJSON(map[string]interface{}{
+			"join_ref": "1",
+			"topic":    "tracked",
+			"event":    "event",
+			"payload":  map[string]interface{}{"type": "click", "event": event, "value": map[string]interface{}{}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to send event: %v", err)
+		}
+	}
+	push := func(event string) []interface{} {
+		t.Helper()
+		send(event)
+		msg := readMessage(t, ws)
+		return msg["payload"].(map[string]interface{})["d"].([]interface{})
+	}
+
+	// Only the part depending on count is sent
+	if d := push("inc"); d[0] != "1" || d[1] != nil {
+		t.Errorf("Expected only the count part to change, got %v", d)
+	}
+
+	// Nothing assigned: the view is not rendered and no diff is sent, so
+	// the next message is the diff of the following event
+	renders := view.renders.Load()
+	send("noop")
+	if d := push("inc"); d[0] != "2" {
+		t.Errorf("Expected no diff for noop, then count 2, got %v", d)
+	}
+	if view.renders.Load() != renders+1 {
+		t.Error("Expected Render to be skipped when no declared assign changed")
+	}
+	if view.stale.Load() {
+		t.Error("Expected Changed to be reset after each render")
+	}
+}
+
+// AsyncLiveView loads its report in the background
+type AsyncLiveView struct {
+	TestLiveView
+	release chan struct{}
+}
+
+func (v *AsyncLiveView) Mount(ctx *liveview.Context, params url.Values) error {
+	ctx.AssignAsync([]string{"report", "broken"}, func(ctx context.Context) (map[string]interface{}, error) {
+		<-v.release
+		return map[string]interface{}{"report": 42}, nil
+	})
+	ctx.AssignAsync([]string{"other"}, func(ctx context.Context) (map[string]interface{}, error) {
+		<-v.release
+		return nil, fmt.Errorf("boom")
+	})
+	return nil
+}
+
+func (v *AsyncLiveView) Render(ctx *liveview.Context) templ.Component {
+	show := func(key string) string {
+		r := liveview.Key[liveview.AsyncResult](key).Get(ctx)
+		switch {
+		case r.Loading:
+			return "loading"
+		case r.Failed():
+			return "failed"
+		default:
+			return fmt.Sprint(r.Result)
+		}
+	}
+	parts := []string{show("report"), show("broken"), show("other")}
+	return templ.ComponentFunc(func(_ context.Context, w io.Writer) error {
+		_, err := fmt.Fprintf(w, `<p><!--$0-->%s<!--/$0--> <!--$1-->%s<!--/$1--> <!--$2-->%s<!--/$2--></p>`, parts[0], parts[1], parts[2])
+		return err
+	})
+}
+
+func TestAssignAsync(t *testing.T) {
+	release := make(chan struct{})
+
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	manager.Register("async", func() liveview.LiveView {
+		return &AsyncLiveView{release: release}
+	})
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{})
+
+	ws, _ := dialTest(t, handler)
+	msg := joinTopic(t, ws, "async", nil)
+	rendered := msg["payload"].(map[string]interface{})["response"].(map[string]interface{})["rendered"].(map[string]interface{})
+	if d := rendered["d"].([]interface{}); d[0] != "loading" || d[1] != "loading" || d[2] != "loading" {
+		t.Errorf("Expected loading results in join reply, got %v", d)
+	}
+
+	close(release)
+	got := map[int]interface{}{}
+	for len(got) < 3 {
+		msg = readMessage(t, ws)
+		if msg["event"] != "diff" {
+			t.Fatalf("Expected diff, got %v", msg["event"])
+		}
+		for i, v := range msg["payload"].(map[string]interface{})["d"].([]interface{}) {
+			if v != nil {
+				got[i] = v
+			}
+		}
+	}
+	if got[0] != "42" || got[1] != "failed" || got[2] != "failed" {
+		t.Errorf("Expected [42 failed failed], got %v", got)
+	}
+}
+
+// TaskLiveView runs named background tasks
+type TaskLiveView struct {
+	TestLiveView
+	stopped chan string
+	handled chan string
+}
+
+func (v *TaskLiveView) Mount(ctx *liveview.Context, params url.Values) error {
+	for _, name := range []string{"watch", "cancel-me"} {
+		ctx.StartAsync(name, func(ctx context.Context) (interface{}, error) {
+			<-ctx.Done()
+			v.stopped <- name
+			return nil, ctx.Err()
+		})
+	}
+	return nil
+}
+
+func (v *TaskLiveView) HandleEvent(ctx *liveview.Context, event string, payload map[string]interface{}) error {
+	switch event {
+	case "cancel":
+		ctx.CancelAsync("cancel-me")
+	case "run":
+		ctx.StartAsync("job", func(ctx context.Context) (interface{}, error) {
+			return 7, nil
+		})
+	}
+	return nil
+}
+
+func (v *TaskLiveView) HandleAsync(ctx *liveview.Context, name string, result interface{}, err error) error {
+	v.handled <- name
+	ctx.Assign("result", result)
+	return err
+}
+
+func (v *TaskLiveView) Render(ctx *liveview.Context) templ.Component {
+	result := fmt.Sprint(ctx.Assigns["result"])
+	return templ.ComponentFunc(func(_ context.Context, w io.Writer) error {
+		_, err := fmt.Fprintf(w, `<p><!--$0-->%s<!--/$0--></p>`, result)
+		return err
+	})
+}
+
+func TestStartAsync(t *testing.T) {
+	view := &TaskLiveView{
+		stopped: make(chan string, 2),
+		handled: make(chan string, 3),
+	}
+
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	manager.Register("tasks", func() liveview.LiveView { return view })
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{})
+
+	ws, _ := dialTest(t, handler)
+	send := func(event string, payload map[string]interface{}) {
+		t.Helper()
+		err := ws.WriteJSON(map[string]interface{}{
+			"join_ref": "1",
+			"ref":      "1",
+			"topic":    "tasks",
+			"event":    event,
+			"payload":  payload,
+		})
+		if err != nil {
+			t.Fatalf("Failed to send %s: %v", event, err)
+		}
+	}
+	waitStopped := func(want string) {
+		t.Helper()
+		select {
+		case name := <-view.stopped:
+			if name != want {
+				t.Errorf("Expected %s to be cancelled, got %s", want, name)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for %s to be cancelled", want)
+		}
+	}
+
+	joinTopic(t, ws, "tasks", nil)
+
+	send("event", map[string]interface{}{"type": "click", "event": "cancel", "value": map[string]interface{}{}})
+	waitStopped("cancel-me")
+
+	send("event", map[string]interface{}{"type": "click", "event": "run", "value": map[string]interface{}{}})
+	for {
+		msg := readMessage(t, ws)
+		if msg["event"] != "diff" {
+			continue
+		}
+		if d := msg["payload"].(map[string]interface{})["d"].([]interface{}); d[0] == "7" {
+			break
+		}
+	}
+
+	ws.Close()
+	waitStopped("watch")
+
+	// Cancelled tasks are not handed to HandleAsync
+	if name := <-view.handled; name != "job" {
+		t.Errorf("Expected HandleAsync for job, got %s", name)
+	}
+	select {
+	case name := <-view.handled:
+		t.Errorf("Expected no HandleAsync after job, got %s", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// FeedLiveView renders its items in an append-only part
+type FeedLiveView struct {
+	TestLiveView
+	next int
+}
+
+func (v *FeedLiveView) Mount(ctx *liveview.Context, params url.Values) error {
+	ctx.AssignTemporary("items", []int(nil), []int(nil))
+	return nil
+}
+
+func (v *FeedLiveView) HandleEvent(ctx *liveview.Context, event string, payload map[string]interface{}) error {
+	if event == "add" {
+		v.next++
+		ctx.AssignTemporary("items", []int{v.next}, []int(nil))
+	}
+	return nil
+}
+
+func (v *FeedLiveView) Render(ctx *liveview.Context) templ.Component {
+	items := ""
+	for _, item := range liveview.GetOr(ctx, "items", []int(nil)) {
+		items += fmt.Sprintf("<li>%d</li>", item)
+	}
+	return templ.ComponentFunc(func(_ context.Context, w io.Writer) error {
+		_, err := fmt.Fprintf(w, `<ul><!--$0+:items-->%s<!--/$0--></ul><p><!--$1-->%d<!--/$1--></p>`, items, v.next)
+		return err
+	})
+}
+
+func TestAssignTemporary(t *testing.T) {
+	view := &FeedLiveView{}
+
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	manager.Register("feed", func() liveview.LiveView { return view })
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{})
+
+	ws, _ := dialTest(t, handler)
+	send := func(event string, payload map[string]interface{}) {
+		t.Helper()
+		err := ws.WriteJSON(map[string]interface{}{
+			"join_ref": "1",
+			"topic":    "feed",
+			"event":    event,
+			"payload":  payload,
+		})
+		if err != nil {
+			t.Fatalf("Failed to send %s: %v", event, err)
+		}
+	}
+	diff := func() []interface{} {
+		t.Helper()
+		msg := readMessage(t, ws)
+		if msg["event"] != "diff" {
+			t.Fatalf("Expected diff, got %v", msg["event"])
+		}
+		return msg["payload"].(map[string]interface{})["d"].([]interface{})
+	}
+
+	joinTopic(t, ws, "feed", nil)
+
+	for i := 1; i <= 2; i++ {
+		send("event", map[string]interface{}{"type": "click", "event": "add", "value": map[string]interface{}{}})
+		d := diff()
+		patch, _ := d[0].(map[string]interface{})
+		if patch["a"] != true || patch["d"].([]interface{})[0] != fmt.Sprintf("<li>%d</li>", i) {
+			t.Fatalf("Expected only item %d to be appended, got %v", i, d[0])
+		}
+	}
+
+	// Once rendered, the items are reset and nothing is appended
+	send("event", map[string]interface{}{"type": "click", "event": "noop", "value": map[string]interface{}{}})
+	if d := diff(); d[0] != nil {
+		t.Errorf("Expected nothing appended after reset, got %v", d[0])
+	}
+}
+
+func TestAssignTemporaryRestore(t *testing.T) {
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	manager.SetReconnectStrategy(liveview.ReconnectRestore, time.Second)
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{
+		Template: `{{.Session}}`,
+		Secret:   "test-secret",
+	})
+	router := liveview.NewRouter(manager, handler)
+	router.Live("/feed", func() liveview.LiveView {
+		return &FeedLiveView{}
+	})
+	topic := liveview.RouteTopic("/feed")
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/feed", nil))
+	payload := map[string]interface{}{
+		"params":  map[string]interface{}{},
+		"session": rec.Body.String(),
+	}
+
+	ws, _ := dialTest(t, router)
+	joinTopic(t, ws, topic, payload)
+	err := ws.WriteJSON(map[string]interface{}{
+		"join_ref": "1",
+		"topic":    topic,
+		"event":    "event",
+		"payload":  map[string]interface{}{"type": "click", "event": "add", "value": map[string]interface{}{}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to send event: %v", err)
+	}
+	readMessage(t, ws)
+	ws.Close()
+
+	// The full render of the restored view appends nothing, so the client
+	// keeps the items it has instead of replacing them
+	time.Sleep(100 * time.Millisecond)
+	ws, _ = dialTest(t, router)
+	msg := joinTopic(t, ws, topic, payload)
+	rendered := msg["payload"].(map[string]interface{})["response"].(map[string]interface{})["rendered"].(map[string]interface{})
+	d := rendered["d"].([]interface{})
+	patch, _ := d[0].(map[string]interface{})
+	if patch["a"] != true || patch["d"].([]interface{})[0] != "" {
+		t.Errorf("Expected an empty append for the items, got %v", d[0])
+	}
+	if d[1] != "1" {
+		t.Errorf("Expected restored count 1, got %v", d[1])
+	}
+}
+
+// SongsLiveView renders its songs as a stream
+type SongsLiveView struct {
+	TestLiveView
+}
+
+func songKey(item interface{}) string {
+	return item.(string)
+}
+
+func (v *SongsLiveView) Mount(ctx *liveview.Context, params url.Values) error {
+	ctx.Stream("songs", []interface{}{"a", "b"}, songKey)
+	return nil
+}
+
+func (v *SongsLiveView) HandleEvent(ctx *liveview.Context, event string, payload map[string]interface{}) error {
+	switch event {
+	case "add":
+		ctx.StreamInsert("songs", "c", 0)
+	case "delete":
+		ctx.StreamDelete("songs", "a")
+	case "reset":
+		ctx.StreamReset("songs")
+		ctx.StreamInsert("songs", "d", -1)
+	}
+	return nil
+}
+
+func (v *SongsLiveView) Render(ctx *liveview.Context) templ.Component {
+	rows := ""
+	for _, e := range ctx.StreamEntries("songs") {
+		rows += fmt.Sprintf(`<li id="%s">%s</li>`, e.ID, e.Item)
+	}
+	return templ.ComponentFunc(func(_ context.Context, w io.Writer) error {
+		_, err := fmt.Fprintf(w, `<ul><!--$0@:songs-->%s<!--/$0--></ul>`, rows)
+		return err
+	})
+}
+
+func TestStreams(t *testing.T) {
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	manager.Register("songs", func() liveview.LiveView { return &SongsLiveView{} })
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{})
+
+	ws, _ := dialTest(t, handler)
+	send := func(event string, payload map[string]interface{}) {
+		t.Helper()
+		err := ws.WriteJSON(map[string]interface{}{
+			"join_ref": "1",
+			"topic":    "songs",
+			"event":    event,
+			"payload":  payload,
+		})
+		if err != nil {
+			t.Fatalf("Failed to send %s: %v", event, err)
+		}
+	}
+	push := func(event string) map[string]interface{} {
+		t.Helper()
+		send("event", map[string]interface{}{"type": "click", "event": event, "value": map[string]interface{}{}})
+		msg := readMessage(t, ws)
+		if msg["event"] != "diff" {
+			t.Fatalf("Expected diff, got %v", msg["event"])
+		}
+		part, _ := msg["payload"].(map[string]interface{})["d"].([]interface{})[0].(map[string]interface{})
+		return part
+	}
+	check := func(part map[string]interface{}, html, ops string) {
+		t.Helper()
+		got, _ := json.Marshal(part["stream"])
+		if d := part["d"].([]interface{}); d[0] != html || string(got) != ops {
+			t.Errorf("Expected %s with %s, got %v with %s", html, ops, d[0], got)
+		}
+	}
+
+	msg := joinTopic(t, ws, "songs", nil)
+	rendered := msg["payload"].(map[string]interface{})["response"].(map[string]interface{})["rendered"].(map[string]interface{})
+	check(rendered["d"].([]interface{})[0].(map[string]interface{}),
+		`<li id="songs-a">a</li><li id="songs-b">b</li>`,
+		`{"inserts":[{"at":-1,"id":"songs-a"},{"at":-1,"id":"songs-b"}],"name":"songs"}`)
+
+	// Only the inserted row is sent
+	check(push("add"), `<li id="songs-c">c</li>`, `{"inserts":[{"at":0,"id":"songs-c"}],"name":"songs"}`)
+
+	// An event without stream operations sends no diff
+	send("event", map[string]interface{}{"type": "click", "event": "noop", "value": map[string]interface{}{}})
+	check(push("delete"), ``, `{"deletes":["songs-a"],"name":"songs"}`)
+	check(push("reset"), `<li id="songs-d">d</li>`, `{"inserts":[{"at":-1,"id":"songs-d"}],"name":"songs","reset":true}`)
+}
+
+// FlashLiveView shows the info flash and carries it to other pages
+type FlashLiveView struct {
+	TestLiveView
+}
+
+func (v *FlashLiveView) HandleEvent(ctx *liveview.Context, event string, payload map[string]interface{}) error {
+	switch event {
+	case "save":
+		ctx.Socket.PutFlash("info", "Saved")
+	case "go":
+		ctx.Socket.PutFlash("info", "Moved")
+		return ctx.PushNavigate("/target")
+	case "leave":
+		return ctx.Redirect("/plain")
+	}
+	return nil
+}
+
+func (v *FlashLiveView) Render(ctx *liveview.Context) templ.Component {
+	info := ctx.Flash("info")
+	return templ.ComponentFunc(func(_ context.Context, w io.Writer) error {
+		_, err := fmt.Fprintf(w, `<p><!--$0-->%s<!--/$0--></p>`, info)
+		return err
+	})
+}
+
+func TestFlash(t *testing.T) {
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	manager.Register("flash", func() liveview.LiveView { return &FlashLiveView{} })
+	manager.Register("target", func() liveview.LiveView { return &FlashLiveView{} })
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{Secret: "test-secret"})
+
+	signer := lvsession.NewManager("test-secret")
+	page, _ := signer.Create("", map[string]interface{}{"view": "flash"})
+	pageToken, _ := signer.Encode(page)
+
+	ws, _ := dialTest(t, handler)
+	send := func(topic, ref, event string, payload map[string]interface{}) {
+		t.Helper()
+		err := ws.WriteJSON(map[string]interface{}{
+			"join_ref": ref,
+			"ref":      ref,
+			"topic":    topic,
+			"event":    event,
+			"payload":  payload,
+		})
+		if err != nil {
+			t.Fatalf("Failed to send %s: %v", event, err)
+		}
+	}
+	push := func(topic, ref, event, value string) map[string]interface{} {
+		t.Helper()
+		send(topic, ref, "event", map[string]interface{}{"type": "click", "event": event, "value": map[string]interface{}{"value": value}})
+		return readMessage(t, ws)
+	}
+	part := func(msg map[string]interface{}) interface{} {
+		t.Helper()
+		if msg["event"] != "diff" {
+			t.Fatalf("Expected diff, got %v", msg["event"])
+		}
+		return msg["payload"].(map[string]interface{})["d"].([]interface{})[0]
+	}
+
+	joinTopic(t, ws, "flash", map[string]interface{}{"params": map[string]interface{}{}, "session": pageToken})
+
+	if d := part(push("flash", "1", "save", "")); d != "Saved" {
+		t.Errorf("Expected flash after PutFlash, got %v", d)
+	}
+	if d := part(push("flash", "1", "lv:clear-flash", "info")); d != "" {
+		t.Errorf("Expected flash to be cleared, got %v", d)
+	}
+
+	// The flash survives a live navigation through the session token
+	part(push("flash", "1", "go", ""))
+	msg := readMessage(t, ws)
+	if msg["event"] != "live_redirect" {
+		t.Fatalf("Expected live_redirect, got %v", msg["event"])
+	}
+	token := msg["payload"].(map[string]interface{})["session"]
+	msg = joinTopicRef(t, ws, "target", "2", map[string]interface{}{"params": map[string]interface{}{}, "session": token})
+	rendered := msg["payload"].(map[string]interface{})["response"].(map[string]interface{})["rendered"].(map[string]interface{})
+	if d := rendered["d"].([]interface{}); d[0] != "Moved" {
+		t.Errorf("Expected flash after navigation, got %v", d[0])
+	}
+
+	// A redirect to a regular page carries it in a signed cookie
+	msg = push("target", "2", "leave", "")
+	if msg["event"] != "diff" {
+		t.Fatalf("Expected diff, got %v", msg["event"])
+	}
+	msg = readMessage(t, ws)
+	redirect := msg["payload"].(map[string]interface{})
+	if msg["event"] != "live_redirect" || redirect["kind"] != "redirect" || redirect["url"] != "/plain" {
+		t.Fatalf("Expected redirect to /plain, got %v", msg)
+	}
+	flashToken, _ := redirect["flash"].(string)
+
+	req := httptest.NewRequest("GET", "/plain", nil)
+	req.AddCookie(&http.Cookie{Name: "_lv_flash", Value: flashToken})
+	rec := httptest.NewRecorder()
+	if flash := handler.Flash(rec, req); flash["info"] != "Moved" {
+		t.Errorf("Expected flash on the regular page, got %v", flash)
+	}
+	if cookies := rec.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("Expected the flash cookie to be cleared, got %v", cookies)
+	}
+
+	// The flash token is not a session token
+	if reason := errorReason(t, joinTopicRef(t, ws, "flash", "3", map[string]interface{}{"params": map[string]interface{}{}, "session": flashToken})); reason != "invalid_session" {
+		t.Errorf("Expected invalid_session for a flash token, got %q", reason)
+	}
+}
+
+// EscapeLiveView renders untrusted input the way templ's { value } does
+type EscapeLiveView struct {
+	TestLiveView
+}
+
+func (v *EscapeLiveView) Render(ctx *liveview.Context) templ.Component {
+	return templ.ComponentFunc(func(_ context.Context, w io.Writer) error {
+		_, err := io.WriteString(w, `<p><!--$0-->`+templ.EscapeString(`<b>"Tom" & Jerry</b>`)+`<!--/$0--></p>`)
+		return err
+	})
+}
+
+func TestDynamicPartsEscapedOnce(t *testing.T) {
+	wsServer := socket.NewServer()
+	manager := liveview.NewManager(wsServer)
+	manager.Register("escape", func() liveview.LiveView {
+		return &EscapeLiveView{}
+	})
+	handler := liveview.NewHandler(manager, wsServer, liveview.HandlerOptions{})
+
+	ws, _ := dialTest(t, handler)
+
+	// The client inserts parts as is, so they must carry templ's escaping
+	// exactly once
+	msg := joinTopic(t, ws, "escape", nil)
+	rendered := msg["payload"].(map[string]interface{})["response"].(map[string]interface{})["rendered"].(map[string]interface{})
+	want := `&lt;b&gt;&#34;Tom&#34; &amp; Jerry&lt;/b&gt;`
+	if d := rendered["d"].([]interface{}); d[0] != want {
+		t.Errorf("Expected part %s, got %v", want, d[0])
+	}
+}
@@ -4,29 +4,42 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/a-h/templ"
 	"github.com/fu2hito/go-liveview/internal/protocol"
 	"github.com/fu2hito/go-liveview/internal/render"
+	lvsession "github.com/fu2hito/go-liveview/internal/session"
 	"github.com/fu2hito/go-liveview/internal/socket"
 )
 
-// session holds LiveView instance and context together
-type session struct {
-	lv  LiveView
-	ctx *Context
-}
-
 // Manager manages LiveView instances
 type Manager struct {
 	liveViews   map[string]func() LiveView
 	sessions    map[string]*session
+	channels    map[channelKey]*session
+	routes      map[string]*route
+	routeMux    *http.ServeMux
 	broadcaster *Broadcaster
-	mu          sync.RWMutex
-	server      *socket.Server
+	signer      *lvsession.Manager
+
+	reconnect      ReconnectStrategy
+	reconnectGrace time.Duration
+	parked         map[string]*session
+	stateStore     StateStore
+	closing        bool
+	staticDigest   string
+
+	crashReporter CrashReporter
+	restartPolicy RestartPolicy
+	crashes       map[channelKey][]time.Time
+	mu            sync.RWMutex
+	server        *socket.Server
 }
 
 // SetBroadcaster sets the broadcaster for the manager
@@ -41,11 +54,21 @@ func (m *Manager) GetBroadcaster() *Broadcaster {
 
 // NewManager creates a new LiveView manager
 func NewManager(server *socket.Server) *Manager {
-	return &Manager{
+	m := &Manager{
 		liveViews: make(map[string]func() LiveView),
 		sessions:  make(map[string]*session),
+		channels:  make(map[channelKey]*session),
+		routes:    make(map[string]*route),
+		routeMux:  http.NewServeMux(),
+		parked:    make(map[string]*session),
 		server:    server,
+
+		crashReporter: logCrashReporter{},
+		restartPolicy: DefaultRestartPolicy,
+		crashes:       make(map[channelKey][]time.Time),
 	}
+	server.OnClose(m.handleClose)
+	return m
 }
 
 // Register registers a LiveView for a topic
@@ -64,15 +87,183 @@ func (m *Manager) handleMessage(ctx context.Context, conn *socket.Conn, msg *pro
 		m.handleJoin(ctx, conn, msg)
 	case "event":
 		m.handleEvent(ctx, conn, msg)
+	case "live_patch":
+		m.handlePatch(ctx, conn, msg)
+	case "live_redirect":
+		m.handleRedirect(ctx, conn, msg)
 	case "phx_leave":
 		m.handleLeave(ctx, conn, msg)
 	}
 }
 
 func (m *Manager) handleJoin(ctx context.Context, conn *socket.Conn, msg *protocol.Message) {
+	joinRef := ""
+	if msg.JoinRef != nil {
+		joinRef = *msg.JoinRef
+	} else if msg.Ref != nil {
+		joinRef = *msg.Ref
+	}
+	if m.shuttingDown() {
+		reply := protocol.NewErrorReply(msg.Topic, messageRef(msg), protocol.ReasonShutdown)
+		reply.JoinRef = &joinRef
+		conn.Send(reply)
+		return
+	}
+
+	if m.reattach(conn, msg, joinRef) {
+		return
+	}
+
+	sess := newSession(ctx, m, conn, msg.Topic, joinRef)
+
+	if !m.allowRestart(sess.key()) {
+		log.Printf("Too many restarts for %s on connection: %s", msg.Topic, conn.ID())
+		reply := protocol.NewErrorReply(msg.Topic, messageRef(msg), protocol.ReasonTooManyRestarts)
+		reply.JoinRef = &joinRef
+		conn.Send(reply)
+		sess.stop()
+		return
+	}
+	sess.onPanic = func(v interface{}, stack []byte) {
+		m.crash(sess, v, stack)
+	}
+
+	m.mu.Lock()
+	prev, ok := m.channels[sess.key()]
+	m.channels[sess.key()] = sess
+	m.sessions[sess.id] = sess
+	m.mu.Unlock()
+	conn.Join(msg.Topic)
+
+	// A rejoin on the same topic replaces the previous channel
+	if ok {
+		m.closeSession(prev, TerminateLeave)
+	}
+
+	go sess.run()
+	sess.send(func() { m.mount(sess, msg) })
+}
+
+func (m *Manager) handleEvent(ctx context.Context, conn *socket.Conn, msg *protocol.Message) {
+	if sess, ok := m.joinedChannel(conn, msg); ok {
+		sess.send(func() { m.event(sess, msg) })
+	}
+}
+
+func (m *Manager) handlePatch(ctx context.Context, conn *socket.Conn, msg *protocol.Message) {
+	if sess, ok := m.joinedChannel(conn, msg); ok {
+		sess.send(func() { m.patch(sess, msg) })
+	}
+}
+
+func (m *Manager) handleRedirect(ctx context.Context, conn *socket.Conn, msg *protocol.Message) {
+	if sess, ok := m.joinedChannel(conn, msg); ok {
+		sess.send(func() { m.redirect(sess, msg) })
+	}
+}
+
+func (m *Manager) handleLeave(ctx context.Context, conn *socket.Conn, msg *protocol.Message) {
+	sess, ok := m.lookupChannel(conn, msg)
+	if !ok {
+		return
+	}
+
+	// Leave is queued behind any pending events so they still get handled
+	m.closeSession(sess, TerminateLeave)
+}
+
+// lookupChannel returns the session joined on msg.Topic over conn. Messages
+// carrying the join_ref of an earlier join are treated as stale.
+func (m *Manager) lookupChannel(conn *socket.Conn, msg *protocol.Message) (*session, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sess, ok := m.channels[channelKey{conn: conn.ID(), topic: msg.Topic}]
+	if !ok {
+		return nil, false
+	}
+	if msg.JoinRef != nil && *msg.JoinRef != sess.joinRef {
+		return nil, false
+	}
+	return sess, true
+}
+
+// joinedChannel is like lookupChannel, but replies with a stale error when
+// the message does not belong to a joined channel
+func (m *Manager) joinedChannel(conn *socket.Conn, msg *protocol.Message) (*session, bool) {
+	sess, ok := m.lookupChannel(conn, msg)
+	if !ok {
+		log.Printf("No session found for %s on connection: %s", msg.Topic, conn.ID())
+		if msg.Ref != nil {
+			conn.Send(protocol.NewErrorReply(msg.Topic, *msg.Ref, protocol.ReasonStale))
+		}
+	}
+	return sess, ok
+}
+
+// handleClose terminates every session that was running on conn
+func (m *Manager) handleClose(conn *socket.Conn) {
+	m.forgetCrashes(conn.ID())
+
+	for _, topic := range conn.Topics() {
+		m.mu.RLock()
+		sess, ok := m.channels[channelKey{conn: conn.ID(), topic: topic}]
+		m.mu.RUnlock()
+
+		if ok {
+			sess.send(func() { m.disconnect(sess) })
+		}
+	}
+}
+
+// closeSession queues termination of sess behind its pending mailbox entries
+func (m *Manager) closeSession(sess *session, reason TerminateReason) {
+	sess.send(func() { m.terminate(sess, reason) })
+}
+
+// terminate runs on the session loop. It calls Terminate on the LiveView,
+// drops the session from the session tables and stops its loop.
+func (m *Manager) terminate(sess *session, reason TerminateReason) {
+	if t, ok := sess.lv.(Terminator); ok {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("Terminate panicked for %s: %v", sess.id, r)
+				}
+			}()
+			t.Terminate(sess.ctx, reason)
+		}()
+	}
+
+	m.mu.Lock()
+	conn := sess.conn
+	// A rejoin with the same join ref registers its session under the same
+	// ID, so only drop the entry while it is still ours
+	if m.sessions[sess.id] == sess {
+		delete(m.sessions, sess.id)
+	}
+	current := m.channels[sess.key()] == sess
+	if current {
+		delete(m.channels, sess.key())
+	}
+	if sess.token != "" && m.parked[sess.token] == sess {
+		delete(m.parked, sess.token)
+		sess.parkTimer.Stop()
+	}
+	m.mu.Unlock()
+
+	if current {
+		conn.Leave(sess.topic)
+	}
+	sess.stop()
+}
+
+// mount runs on the session loop and performs the initial Mount and Render
+func (m *Manager) mount(sess *session, msg *protocol.Message) {
 	var joinPayload protocol.JoinPayload
 	if err := unmarshalPayload(msg.Payload, &joinPayload); err != nil {
 		log.Printf("Failed to unmarshal join payload: %v", err)
+		m.rejectJoin(sess, msg, protocol.ReasonBadRequest)
 		return
 	}
 
@@ -82,14 +273,38 @@ func (m *Manager) handleJoin(ctx context.Context, conn *socket.Conn, msg *protoc
 
 	if !ok {
 		log.Printf("Unknown topic: %s", msg.Topic)
+		m.rejectJoin(sess, msg, protocol.ReasonNotFound)
 		return
 	}
 
+	// Clients running assets from before a deploy reload the page
+	if m.staleStatic(joinPayload.Static) {
+		m.rejectJoin(sess, msg, protocol.ReasonStaleStatic)
+		return
+	}
+
+	signed, err := m.verifySession(joinPayload.Session, msg.Topic)
+	if err != nil {
+		log.Printf("Rejected join for %s: %v", msg.Topic, err)
+		m.rejectJoin(sess, msg, protocol.ReasonInvalidSession)
+		return
+	}
+	sess.token = joinPayload.Session
+
 	// Create new LiveView instance
 	lv := factory()
 
 	// Create context
-	lvCtx := NewContext(ctx, &socketAdapter{conn: conn}, conn.ID())
+	m.mu.RLock()
+	adapter := &socketAdapter{conn: sess.conn}
+	m.mu.RUnlock()
+	lvCtx := NewContext(sess.base, adapter, sess.id)
+	adapter.ctx = lvCtx
+	lvCtx.session = sess
+	lvCtx.connected = true
+	lvCtx.signed = signed
+	lvCtx.flash = signed.flash
+	lvCtx.mounts = mountCount(joinPayload.Params)
 
 	// Set broadcaster if available
 	if m.broadcaster != nil {
@@ -99,13 +314,49 @@ func (m *Manager) handleJoin(ctx context.Context, conn *socket.Conn, msg *protoc
 	// Mount the LiveView
 	params := url.Values{}
 	for k, v := range joinPayload.Params {
-		if s, ok := v.(string); ok {
+		if s, ok := v.(string); ok && k != "_mounts" {
 			params.Set(k, s)
 		}
 	}
+	if joinPayload.URL != "" {
+		u, err := url.Parse(joinPayload.URL)
+		if err != nil {
+			log.Printf("Failed to parse join URL: %v", err)
+			m.rejectJoin(sess, msg, protocol.ReasonBadRequest)
+			return
+		}
+		sess.url = u
+		for k, v := range m.urlParams(sess.topic, u) {
+			if _, ok := params[k]; !ok {
+				params[k] = v
+			}
+		}
+	}
+	sess.lastEvent, sess.lastPayload = "mount", params
 
 	if err := lv.Mount(lvCtx, params); err != nil {
 		log.Printf("Failed to mount LiveView: %v", err)
+		m.rejectJoin(sess, msg, joinErrorReason(err))
+		return
+	}
+
+	// The view is mounted from here on, so a rejected join terminates it
+	sess.lv = lv
+	sess.ctx = lvCtx
+
+	// Rehydrate a session that was parked on another node or before a
+	// restart
+	if s, ok := lv.(Snapshotter); ok && m.restoring() {
+		if data, ok := m.loadSnapshot(sess.token); ok {
+			if err := s.Restore(data); err != nil {
+				log.Printf("Failed to restore session %s: %v", sess.id, err)
+			}
+		}
+	}
+
+	if err := lv.HandleParams(lvCtx, params); err != nil {
+		log.Printf("Failed to handle params: %v", err)
+		m.rejectJoin(sess, msg, joinErrorReason(err))
 		return
 	}
 
@@ -114,86 +365,164 @@ func (m *Manager) handleJoin(ctx context.Context, conn *socket.Conn, msg *protoc
 
 	// Convert templ component to Rendered
 	html := renderComponent(comp)
-	r := render.ParseTemplOutput(html)
-	lvCtx.SetRenderedValue(&BaseRendered{
-		Static:  r.Static,
-		Dynamic: r.Dynamic,
-	})
-
-	// Store session with LiveView instance
-	m.mu.Lock()
-	m.sessions[conn.ID()] = &session{lv: lv, ctx: lvCtx}
-	m.mu.Unlock()
+	r := lvCtx.commitFullRender(render.ParseTemplOutput(html))
 
 	// Send join reply
-	reply := protocol.NewJoinReply(msg.Topic, *msg.Ref, r)
-	conn.Send(reply)
+	reply := protocol.NewJoinReply(msg.Topic, messageRef(msg), r)
+	sess.push(reply)
 }
 
-func (m *Manager) handleEvent(ctx context.Context, conn *socket.Conn, msg *protocol.Message) {
+// rejectJoin sends an error reply for a failed join and drops the session
+func (m *Manager) rejectJoin(sess *session, msg *protocol.Message, reason string) {
+	reply := protocol.NewErrorReply(msg.Topic, messageRef(msg), reason)
+	sess.push(reply)
+	m.terminate(sess, TerminateCrash)
+}
+
+// fail pushes phx_error for a runtime failure and terminates the session so
+// the client can rejoin with a fresh mount
+func (m *Manager) fail(sess *session, reason string) {
+	errMsg := protocol.NewErrorMessage(sess.topic, reason)
+	sess.push(errMsg)
+	m.terminate(sess, TerminateCrash)
+}
+
+// event runs on the session loop and dispatches a client event
+func (m *Manager) event(sess *session, msg *protocol.Message) {
 	var eventPayload protocol.EventPayload
 	if err := unmarshalPayload(msg.Payload, &eventPayload); err != nil {
 		log.Printf("Failed to unmarshal event payload: %v", err)
+		if msg.Ref != nil {
+			sess.push(protocol.NewErrorReply(msg.Topic, *msg.Ref, protocol.ReasonBadRequest))
+		}
+		return
+	}
+
+	if sess.lv == nil {
+		log.Printf("Event for unmounted session: %s", sess.id)
 		return
 	}
 
+	sess.lastEvent, sess.lastPayload = eventPayload.Event, eventPayload.Value
+	if eventPayload.Event == clearFlashEvent {
+		kind, _ := eventPayload.Value["value"].(string)
+		sess.ctx.clearFlash(kind)
+		m.pushDiff(sess)
+		return
+	}
+	if err := sess.lv.HandleEvent(sess.ctx, eventPayload.Event, eventPayload.Value); err != nil {
+		log.Printf("Failed to handle event: %v", err)
+		m.fail(sess, protocol.ReasonEventFailed)
+		return
+	}
+
+	m.pushDiff(sess)
+}
+
+// info runs on the session loop and delivers a server-side message
+func (m *Manager) info(sess *session, msg interface{}) {
+	if sess.lv == nil {
+		return
+	}
+
+	handler, ok := sess.lv.(InfoHandler)
+	if !ok {
+		log.Printf("LiveView for %s does not implement HandleInfo, dropping %T", sess.topic, msg)
+		return
+	}
+
+	sess.lastEvent, sess.lastPayload = "info", msg
+	if err := handler.HandleInfo(sess.ctx, msg); err != nil {
+		log.Printf("Failed to handle info: %v", err)
+		m.fail(sess, protocol.ReasonInfoFailed)
+		return
+	}
+
+	m.pushDiff(sess)
+}
+
+// SendTo delivers msg to the HandleInfo of the session with the given ID.
+// It reports false if no such session is running.
+func (m *Manager) SendTo(sessionID string, msg interface{}) bool {
 	m.mu.RLock()
-	sess, ok := m.sessions[conn.ID()]
+	sess, ok := m.sessions[sessionID]
 	m.mu.RUnlock()
 
 	if !ok {
-		log.Printf("No session found for connection: %s", conn.ID())
+		return false
+	}
+	return m.sendInfo(sess, msg)
+}
+
+// sendInfo queues msg for delivery to the HandleInfo of sess
+func (m *Manager) sendInfo(sess *session, msg interface{}) bool {
+	return sess.send(func() { m.info(sess, msg) })
+}
+
+// pushDiff re-renders the session's LiveView and sends the diff against the
+// previous render to the client
+func (m *Manager) pushDiff(sess *session) {
+	diff, changed := m.renderDiff(sess)
+	if !changed {
+		return
+	}
+	diffMsg, err := protocol.NewDiffMessage(sess.topic, diff)
+	if err != nil {
+		log.Printf("Failed to create diff message: %v", err)
 		return
 	}
+	sess.push(diffMsg)
+}
 
-	// Use existing LiveView instance from session
-	lv := sess.lv
+// renderDiff re-renders the session's LiveView, stores the new render and
+// returns the diff against the previous one. Parts whose markers declare
+// their assigns are only updated when one of those assigns changed, and a
+// view whose parts all declare them is not rendered at all when none did,
+// in which case renderDiff reports no change and an empty diff.
+func (m *Manager) renderDiff(sess *session) (protocol.DiffPayload, bool) {
 	lvCtx := sess.ctx
+	prevRendered := lvCtx.rendered()
 
-	if err := lv.HandleEvent(lvCtx, eventPayload.Event, eventPayload.Value); err != nil {
-		log.Printf("Failed to handle event: %v", err)
-		return
+	if prevRendered != nil && prevRendered.Tracked() && !lvCtx.changedAny(flatten(prevRendered.Deps)) {
+		lvCtx.endRender()
+		return protocol.DiffPayload{Dynamic: make([]interface{}, len(prevRendered.Dynamic))}, false
 	}
 
 	// Re-render
-	comp := lv.Render(lvCtx)
+	comp := sess.lv.Render(lvCtx)
 	html := renderComponent(comp)
 	newRendered := render.ParseTemplOutput(html)
 
 	// Calculate diff
-	var prevRendered *render.Rendered
-	if r := lvCtx.RenderedValue(); r != nil {
-		if br, ok := r.(*BaseRendered); ok {
-			prevRendered = &render.Rendered{
-				Static:  br.Static,
-				Dynamic: br.Dynamic,
+	diff := render.Diff(prevRendered, newRendered)
+	if diff.Static == nil {
+		for i, deps := range newRendered.Deps {
+			if deps != nil && i < len(prevRendered.Dynamic) && !lvCtx.changedAny(deps) {
+				diff.Dynamic[i] = nil
+				newRendered.Dynamic[i] = prevRendered.Dynamic[i]
 			}
 		}
 	}
-	diff := render.Diff(prevRendered, newRendered)
+
+	// Streams send their operations instead of the rendered part
+	diff.Dynamic = lvCtx.withStreams(newRendered, diff.Dynamic, diff.Static != nil)
 
 	// Update stored rendered
-	lvCtx.SetRenderedValue(&BaseRendered{
-		Static:  newRendered.Static,
-		Dynamic: newRendered.Dynamic,
-	})
+	lvCtx.commitRender(newRendered)
 
-	// Send diff
-	diffMsg, err := protocol.NewDiffMessage(msg.Topic, protocol.DiffPayload{
+	return protocol.DiffPayload{
 		Static:  convertToInterfaceSlice(diff.Static),
 		Dynamic: diff.Dynamic,
-	})
-	if err != nil {
-		log.Printf("Failed to create diff message: %v", err)
-		return
-	}
-	conn.Send(diffMsg)
+	}, true
 }
 
-func (m *Manager) handleLeave(ctx context.Context, conn *socket.Conn, msg *protocol.Message) {
-	m.mu.Lock()
-	delete(m.sessions, conn.ID())
-	m.mu.Unlock()
+// flatten joins the dependency lists of all parts
+func flatten(deps [][]string) []string {
+	var keys []string
+	for _, d := range deps {
+		keys = append(keys, d...)
+	}
+	return keys
 }
 
 func renderComponent(comp templ.Component) string {
@@ -204,6 +533,27 @@ func renderComponent(comp templ.Component) string {
 	return buf.String()
 }
 
+// messageRef returns the ref of msg, or an empty string if it has none
+func messageRef(msg *protocol.Message) string {
+	if msg.Ref == nil {
+		return ""
+	}
+	return *msg.Ref
+}
+
+// mountCount reads the number of earlier joins the client sends as the
+// _mounts join param
+func mountCount(params map[string]interface{}) int {
+	switch n := params["_mounts"].(type) {
+	case float64:
+		return int(n)
+	case string:
+		i, _ := strconv.Atoi(n)
+		return i
+	}
+	return 0
+}
+
 func unmarshalPayload(data []byte, target interface{}) error {
 	if err := json.Unmarshal(data, target); err == nil {
 		return nil
@@ -228,6 +578,7 @@ func convertToInterfaceSlice(strs []string) []interface{} {
 // socketAdapter adapts socket.Conn to LiveView Socket interface
 type socketAdapter struct {
 	conn *socket.Conn
+	ctx  *Context
 }
 
 func (s *socketAdapter) PushEvent(event string, payload map[string]interface{}) {
@@ -235,7 +586,7 @@ func (s *socketAdapter) PushEvent(event string, payload map[string]interface{})
 }
 
 func (s *socketAdapter) PutFlash(kind, message string) {
-	// Implementation
+	s.ctx.putFlash(kind, message)
 }
 
 func (s *socketAdapter) AllowUpload(name string, options UploadConfig) {
@@ -0,0 +1,128 @@
+package liveview
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/fu2hito/go-liveview/internal/protocol"
+)
+
+// PushNavigate navigates the client to the LiveView registered for path
+// without a page reload. The current LiveView is terminated once the
+// current callback returns, and the target is mounted on the same
+// connection.
+func (c *Context) PushNavigate(path string) error {
+	if c.session == nil {
+		return fmt.Errorf("push navigate: context is not connected")
+	}
+	u, err := url.Parse(path)
+	if err != nil {
+		return fmt.Errorf("push navigate: %w", err)
+	}
+
+	sess := c.session
+	topic, ok := sess.manager.resolvePath(u.Path)
+	if !ok {
+		return fmt.Errorf("push navigate: no LiveView registered for %s", u.Path)
+	}
+
+	sess.send(func() { sess.manager.pushNavigate(sess, u, topic) })
+	return nil
+}
+
+// resolvePath returns the topic of the LiveView registered for path.
+// Routes registered with Router.Live are tried first, with the same
+// precedence as page requests. Otherwise a topic matches a path either exactly or without its
+// leading slash, so "/counter" resolves to a LiveView registered as
+// "counter".
+func (m *Manager) resolvePath(path string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if topic, ok := m.matchRoute(path); ok {
+		return topic, true
+	}
+
+	if _, ok := m.liveViews[path]; ok {
+		return path, true
+	}
+	topic := strings.Trim(path, "/")
+	if _, ok := m.liveViews[topic]; ok {
+		return topic, true
+	}
+	return "", false
+}
+
+// redirect runs on the session loop and handles a live_redirect from the
+// client. It replies with the topic to join and terminates the session.
+func (m *Manager) redirect(sess *session, msg *protocol.Message) {
+	var redirectPayload protocol.RedirectPayload
+	if err := unmarshalPayload(msg.Payload, &redirectPayload); err != nil {
+		log.Printf("Failed to unmarshal live_redirect payload: %v", err)
+		if msg.Ref != nil {
+			sess.push(protocol.NewErrorReply(msg.Topic, *msg.Ref, protocol.ReasonBadRequest))
+		}
+		return
+	}
+
+	u, err := url.Parse(redirectPayload.URL)
+	if err != nil {
+		log.Printf("Failed to parse live_redirect url: %v", err)
+		if msg.Ref != nil {
+			sess.push(protocol.NewErrorReply(msg.Topic, *msg.Ref, protocol.ReasonBadRequest))
+		}
+		return
+	}
+
+	// Unknown paths are left to the client, which falls back to a full
+	// page load
+	topic, ok := m.resolvePath(u.Path)
+	if !ok {
+		reply := protocol.NewErrorReply(msg.Topic, messageRef(msg), protocol.ReasonNotFound)
+		sess.push(reply)
+		return
+	}
+
+	reply := protocol.NewReply(sess.topic, messageRef(msg), protocol.RedirectPayload{
+		URL:     u.String(),
+		Topic:   topic,
+		Session: m.redirectSession(sess, topic),
+	})
+	sess.push(reply)
+	m.terminate(sess, TerminateLeave)
+}
+
+// pushNavigate runs on the session loop and handles Context.PushNavigate
+func (m *Manager) pushNavigate(sess *session, u *url.URL, topic string) {
+	redirectMsg, err := protocol.NewRedirectMessage(sess.topic, protocol.RedirectPayload{
+		URL:     u.String(),
+		Topic:   topic,
+		Kind:    "push",
+		Session: m.redirectSession(sess, topic),
+	})
+	if err != nil {
+		log.Printf("Failed to create redirect message: %v", err)
+		return
+	}
+	sess.push(redirectMsg)
+	m.terminate(sess, TerminateLeave)
+}
+
+// redirectSession signs the current session for the LiveView on topic, so
+// the user and the flash carry over to the view being navigated to. No
+// token is sent when no session secret is configured.
+func (m *Manager) redirectSession(sess *session, topic string) string {
+	if sess.ctx == nil || !m.hasSessionSecret() {
+		return ""
+	}
+	s := sess.ctx.signed
+	s.flash = sess.ctx.flash
+	token, err := m.signSession(topic, s)
+	if err != nil {
+		log.Printf("Failed to sign session for %s: %v", topic, err)
+		return ""
+	}
+	return token
+}
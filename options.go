@@ -1,15 +1,44 @@
 package liveview
 
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/fu2hito/go-liveview/internal/socket"
+)
+
 // Options configures the LiveView server
 type Options struct {
-	// Secret is the secret key for signing sessions
+	// Secret is the secret key for signing sessions. It is required.
 	Secret string
 
 	// ReconnectStrategy determines how to handle reconnections
 	ReconnectStrategy ReconnectStrategy
 
-	// PubSub is the PubSub adapter for distributed LiveViews
+	// ReconnectGrace is how long a disconnected session is kept for
+	// ReconnectRestore. If zero, DefaultReconnectGrace is used.
+	ReconnectGrace time.Duration
+
+	// StateStore keeps snapshots of LiveViews implementing Snapshotter so
+	// ReconnectRestore works across nodes and restarts. If nil, sessions
+	// are only restored on the node holding them.
+	StateStore StateStore
+
+	// PubSub is the PubSub adapter for distributed LiveViews. If nil, a
+	// LocalPubSub is used.
 	PubSub PubSub
+
+	// Template is the page template, see HandlerOptions.Template. If empty,
+	// DefaultTemplate is used.
+	Template string
+
+	// Session returns the server-side session for a request, see
+	// HandlerOptions.Session
+	Session func(r *http.Request) (Session, error)
+
+	// TrackStatic lists asset files to track, see HandlerOptions.TrackStatic
+	TrackStatic []string
 }
 
 // ReconnectStrategy determines how to handle reconnections
@@ -18,6 +47,68 @@ type ReconnectStrategy int
 const (
 	// ReconnectReset resets the LiveView state on reconnection
 	ReconnectReset ReconnectStrategy = iota
-	// ReconnectRestore restores the LiveView state on reconnection
+	// ReconnectRestore keeps the LiveView running for a grace period after a
+	// disconnect and reattaches it when the client rejoins
 	ReconnectRestore
 )
+
+// Server bundles the pieces of a LiveView application built from Options.
+// LiveViews are registered with Live, and the Server itself is the
+// http.Handler serving pages and the WebSocket.
+type Server struct {
+	*Router
+	Manager     *Manager
+	Handler     *Handler
+	Broadcaster *Broadcaster
+}
+
+// New builds the socket server, manager, broadcaster, session signer and
+// handler from opts
+func New(opts Options) (*Server, error) {
+	if opts.Secret == "" {
+		return nil, fmt.Errorf("liveview: Options.Secret is required to sign sessions")
+	}
+	switch opts.ReconnectStrategy {
+	case ReconnectReset, ReconnectRestore:
+	default:
+		return nil, fmt.Errorf("liveview: unknown Options.ReconnectStrategy %d", opts.ReconnectStrategy)
+	}
+	if opts.ReconnectGrace < 0 {
+		return nil, fmt.Errorf("liveview: Options.ReconnectGrace must not be negative")
+	}
+
+	pubsub := opts.PubSub
+	if pubsub == nil {
+		pubsub = NewLocalPubSub()
+	}
+	tmpl := opts.Template
+	if tmpl == "" {
+		tmpl = DefaultTemplate("Go LiveView", "")
+	}
+
+	wsServer := socket.NewServer()
+	manager := NewManager(wsServer)
+	manager.SetReconnectStrategy(opts.ReconnectStrategy, opts.ReconnectGrace)
+	if opts.StateStore != nil {
+		manager.SetStateStore(opts.StateStore)
+	}
+	broadcaster := NewBroadcaster(pubsub)
+	manager.SetBroadcaster(broadcaster)
+
+	handler := NewHandler(manager, wsServer, HandlerOptions{
+		Template:    tmpl,
+		Secret:      opts.Secret,
+		Session:     opts.Session,
+		TrackStatic: opts.TrackStatic,
+	})
+	if handler.err != nil {
+		return nil, fmt.Errorf("liveview: invalid options: %w", handler.err)
+	}
+
+	return &Server{
+		Router:      NewRouter(manager, handler),
+		Manager:     manager,
+		Handler:     handler,
+		Broadcaster: broadcaster,
+	}, nil
+}
@@ -0,0 +1,111 @@
+package liveview
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+
+	"github.com/fu2hito/go-liveview/internal/protocol"
+)
+
+// PushPatch changes the client's URL to rawURL without remounting. The
+// LiveView's HandleParams is called with the new params, and the resulting
+// diff is sent after the current callback finishes.
+func (c *Context) PushPatch(rawURL string) error {
+	if c.session == nil {
+		return fmt.Errorf("push patch: context is not connected")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("push patch: %w", err)
+	}
+
+	sess := c.session
+	sess.send(func() { sess.manager.pushPatch(sess, u) })
+	return nil
+}
+
+// URL returns the URL the LiveView was last mounted or patched with, or nil
+// if the client did not report one
+func (c *Context) URL() *url.URL {
+	if c.session == nil {
+		return nil
+	}
+	return c.session.url
+}
+
+// patch runs on the session loop and handles a live_patch from the client
+func (m *Manager) patch(sess *session, msg *protocol.Message) {
+	u, err := parsePatch(msg)
+	if err != nil {
+		log.Printf("Failed to parse live_patch: %v", err)
+		if msg.Ref != nil {
+			sess.push(protocol.NewErrorReply(msg.Topic, *msg.Ref, protocol.ReasonBadRequest))
+		}
+		return
+	}
+
+	if !m.applyParams(sess, u, msg) {
+		return
+	}
+
+	// The reply carries the diff even when it is empty
+	diff, _ := m.renderDiff(sess)
+	reply := protocol.NewReply(sess.topic, messageRef(msg), map[string]interface{}{
+		"diff": diff,
+	})
+	sess.push(reply)
+}
+
+// pushPatch runs on the session loop and handles Context.PushPatch
+func (m *Manager) pushPatch(sess *session, u *url.URL) {
+	if !m.applyParams(sess, u, nil) {
+		return
+	}
+
+	patchMsg, err := protocol.NewPatchMessage(sess.topic, protocol.PatchPayload{
+		URL:  u.String(),
+		Kind: "push",
+	})
+	if err != nil {
+		log.Printf("Failed to create patch message: %v", err)
+		return
+	}
+	sess.push(patchMsg)
+	m.pushDiff(sess)
+}
+
+// applyParams records u as the session URL and calls HandleParams. It
+// reports false if HandleParams failed and the session was terminated, in
+// which case msg, the live_patch that asked for u if any, is replied to
+// with an error first.
+func (m *Manager) applyParams(sess *session, u *url.URL, msg *protocol.Message) bool {
+	if sess.lv == nil {
+		return false
+	}
+
+	sess.url = u
+	params := m.urlParams(sess.topic, u)
+	sess.lastEvent, sess.lastPayload = "live_patch", params
+	if err := sess.lv.HandleParams(sess.ctx, params); err != nil {
+		log.Printf("Failed to handle params: %v", err)
+		if msg != nil && msg.Ref != nil {
+			sess.push(protocol.NewErrorReply(msg.Topic, *msg.Ref, protocol.ReasonParamsFailed))
+		}
+		m.fail(sess, protocol.ReasonParamsFailed)
+		return false
+	}
+	return true
+}
+
+// parsePatch decodes the URL carried by a live_patch message
+func parsePatch(msg *protocol.Message) (*url.URL, error) {
+	var patchPayload protocol.PatchPayload
+	if err := unmarshalPayload(msg.Payload, &patchPayload); err != nil {
+		return nil, err
+	}
+	if patchPayload.URL == "" {
+		return nil, fmt.Errorf("missing url")
+	}
+	return url.Parse(patchPayload.URL)
+}
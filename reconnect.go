@@ -0,0 +1,124 @@
+package liveview
+
+import (
+	"time"
+
+	"github.com/fu2hito/go-liveview/internal/protocol"
+	"github.com/fu2hito/go-liveview/internal/render"
+	"github.com/fu2hito/go-liveview/internal/socket"
+)
+
+// DefaultReconnectGrace is how long a disconnected session is kept for
+// ReconnectRestore when no grace period is configured
+const DefaultReconnectGrace = 30 * time.Second
+
+// SetReconnectStrategy sets how sessions that lose their connection are
+// handled. With ReconnectRestore, a session joined with a session token is
+// parked for grace after a disconnect, and a rejoin with the same token
+// reattaches the running LiveView instead of mounting a new one. A zero
+// grace uses DefaultReconnectGrace.
+func (m *Manager) SetReconnectStrategy(strategy ReconnectStrategy, grace time.Duration) {
+	if grace <= 0 {
+		grace = DefaultReconnectGrace
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reconnect = strategy
+	m.reconnectGrace = grace
+}
+
+// restoring reports whether ReconnectRestore is configured
+func (m *Manager) restoring() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.reconnect == ReconnectRestore
+}
+
+// disconnect runs on the session loop after the connection of sess closed.
+// It parks the session when it can be restored and terminates it otherwise.
+func (m *Manager) disconnect(sess *session) {
+	m.mu.Lock()
+	if m.reconnect != ReconnectRestore || sess.token == "" || sess.ctx == nil {
+		m.mu.Unlock()
+		m.terminate(sess, TerminateDisconnect)
+		return
+	}
+
+	if m.channels[sess.key()] == sess {
+		delete(m.channels, sess.key())
+	}
+	prev := m.parked[sess.token]
+	m.parked[sess.token] = sess
+	sess.parkTimer = time.AfterFunc(m.reconnectGrace, func() { m.expire(sess) })
+	m.mu.Unlock()
+
+	// The client may come back on another node
+	m.saveSnapshot(sess)
+
+	// Only one session can be restored per token
+	if prev != nil && prev != sess {
+		prev.parkTimer.Stop()
+		m.closeSession(prev, TerminateDisconnect)
+	}
+}
+
+// expire terminates sess if it is still parked when its grace period ends
+func (m *Manager) expire(sess *session) {
+	m.mu.Lock()
+	parked := m.parked[sess.token] == sess
+	if parked {
+		delete(m.parked, sess.token)
+	}
+	m.mu.Unlock()
+
+	if parked {
+		m.closeSession(sess, TerminateDisconnect)
+	}
+}
+
+// reattach hands a join carrying the token of a parked session to that
+// session and reports whether it did
+func (m *Manager) reattach(conn *socket.Conn, msg *protocol.Message, joinRef string) bool {
+	var joinPayload protocol.JoinPayload
+	if err := unmarshalPayload(msg.Payload, &joinPayload); err != nil || joinPayload.Session == "" {
+		return false
+	}
+
+	// The session is moved onto conn before the join returns, so a close of
+	// conn finds it and parks it again
+	m.mu.Lock()
+	sess, ok := m.parked[joinPayload.Session]
+	if !ok || sess.topic != msg.Topic {
+		m.mu.Unlock()
+		return false
+	}
+	delete(m.parked, joinPayload.Session)
+	sess.parkTimer.Stop()
+	sess.conn = conn
+	sess.joinRef = joinRef
+	prev, replaced := m.channels[sess.key()]
+	m.channels[sess.key()] = sess
+	m.mu.Unlock()
+	conn.Join(msg.Topic)
+
+	if replaced && prev != sess {
+		m.closeSession(prev, TerminateLeave)
+	}
+	sess.send(func() { m.resume(sess, msg, mountCount(joinPayload.Params)) })
+	return true
+}
+
+// resume runs on the session loop and replies to the join that reattached
+// sess with a full render of the running LiveView
+func (m *Manager) resume(sess *session, msg *protocol.Message, mounts int) {
+	m.deleteSnapshot(sess.token)
+
+	lvCtx := sess.ctx
+	lvCtx.mounts = mounts
+	sess.lastEvent, sess.lastPayload = "resume", nil
+
+	r := lvCtx.commitFullRender(render.ParseTemplOutput(renderComponent(sess.lv.Render(lvCtx))))
+
+	sess.push(protocol.NewJoinReply(msg.Topic, messageRef(msg), r))
+}
@@ -0,0 +1,173 @@
+package liveview
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Router maps URL paths to LiveViews. Patterns use the net/http ServeMux
+// syntax, so "/users/{id}/edit" passes the id path value to Mount and
+// HandleParams alongside the query params.
+type Router struct {
+	manager *Manager
+	handler *Handler
+	mux     *http.ServeMux
+}
+
+// NewRouter creates a router that registers LiveViews with manager and
+// serves their pages through handler
+func NewRouter(manager *Manager, handler *Handler) *Router {
+	return &Router{
+		manager: manager,
+		handler: handler,
+		mux:     http.NewServeMux(),
+	}
+}
+
+// Live registers a LiveView for pattern. GET requests matching pattern
+// serve the page, and the client joins the topic derived from pattern.
+func (r *Router) Live(pattern string, factory func() LiveView) {
+	topic := r.manager.registerRoute(pattern, factory)
+	r.mux.HandleFunc("GET "+pattern, func(w http.ResponseWriter, req *http.Request) {
+		r.handler.serveLive(w, req, topic)
+	})
+}
+
+// Handle registers a plain HTTP handler for pattern, e.g. for static files
+func (r *Router) Handle(pattern string, h http.Handler) {
+	r.mux.Handle(pattern, h)
+}
+
+// ServeHTTP implements http.Handler
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if isWebSocketUpgrade(req) {
+		r.handler.server.ServeHTTP(w, req)
+		return
+	}
+	r.mux.ServeHTTP(w, req)
+}
+
+// RouteTopic returns the channel topic used for a LiveView registered with
+// Router.Live under pattern
+func RouteTopic(pattern string) string {
+	return "lv:" + pattern
+}
+
+// registerRoute registers factory under the topic derived from pattern and
+// returns that topic
+func (m *Manager) registerRoute(pattern string, factory func() LiveView) string {
+	rt := newRoute(pattern)
+
+	m.mu.Lock()
+	if _, ok := m.routes[rt.topic]; !ok {
+		m.routeMux.HandleFunc("GET "+pattern, func(http.ResponseWriter, *http.Request) {})
+	}
+	m.routes[rt.topic] = rt
+	m.mu.Unlock()
+
+	m.Register(rt.topic, factory)
+	return rt.topic
+}
+
+// matchRoute returns the topic of the route registered for path. Routes
+// share one ServeMux, so the most specific pattern wins as it does for the
+// page request.
+func (m *Manager) matchRoute(path string) (string, bool) {
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    &url.URL{Path: path},
+		Header: http.Header{},
+	}
+	_, pattern := m.routeMux.Handler(req)
+	if pattern == "" {
+		return "", false
+	}
+	return RouteTopic(strings.TrimPrefix(pattern, "GET ")), true
+}
+
+// urlParams returns the params a LiveView sees for u: the query params,
+// overlaid with the path values of the route registered for topic
+func (m *Manager) urlParams(topic string, u *url.URL) url.Values {
+	params := u.Query()
+
+	m.mu.RLock()
+	rt, ok := m.routes[topic]
+	m.mu.RUnlock()
+
+	if ok {
+		if values, ok := rt.match(u.Path); ok {
+			for k, v := range values {
+				params[k] = v
+			}
+		}
+	}
+	return params
+}
+
+// route is a LiveView registered by path pattern
+type route struct {
+	pattern string
+	topic   string
+	names   []string
+	mux     *http.ServeMux
+}
+
+// routeMatchKey carries the destination for path values through the
+// request context while matching
+type routeMatchKey struct{}
+
+func newRoute(pattern string) *route {
+	rt := &route{
+		pattern: pattern,
+		topic:   RouteTopic(pattern),
+		names:   wildcardNames(pattern),
+		mux:     http.NewServeMux(),
+	}
+	rt.mux.HandleFunc("GET "+pattern, func(w http.ResponseWriter, req *http.Request) {
+		values := req.Context().Value(routeMatchKey{}).(*url.Values)
+		*values = url.Values{}
+		for _, name := range rt.names {
+			values.Set(name, req.PathValue(name))
+		}
+	})
+	return rt
+}
+
+// match reports whether path matches the route pattern and returns its
+// path values
+func (rt *route) match(path string) (url.Values, bool) {
+	var values url.Values
+	ctx := context.WithValue(context.Background(), routeMatchKey{}, &values)
+	req := (&http.Request{
+		Method: http.MethodGet,
+		URL:    &url.URL{Path: path},
+		Header: http.Header{},
+	}).WithContext(ctx)
+
+	rt.mux.ServeHTTP(discardResponse{}, req)
+	return values, values != nil
+}
+
+// discardResponse is a ResponseWriter that drops everything written to it
+type discardResponse struct{}
+
+func (discardResponse) Header() http.Header         { return http.Header{} }
+func (discardResponse) Write(b []byte) (int, error) { return len(b), nil }
+func (discardResponse) WriteHeader(int)             {}
+
+// wildcardNames returns the wildcard names in a ServeMux pattern
+func wildcardNames(pattern string) []string {
+	var names []string
+	for _, seg := range strings.Split(pattern, "/") {
+		if !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") {
+			continue
+		}
+		name := strings.TrimSuffix(seg[1:len(seg)-1], "...")
+		if name != "$" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
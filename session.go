@@ -0,0 +1,159 @@
+package liveview
+
+import (
+	"context"
+	"net/url"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/fu2hito/go-liveview/internal/protocol"
+	"github.com/fu2hito/go-liveview/internal/socket"
+)
+
+// session holds LiveView instance and context together, and owns the
+// goroutine that processes every callback for that LiveView in order
+type session struct {
+	id      string
+	manager *Manager
+	lv      LiveView
+	ctx     *Context
+	topic   string
+	url     *url.URL
+	token   string
+	base    context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+	once    sync.Once
+
+	// onPanic is called on the session loop when a mailbox entry panics
+	onPanic func(v interface{}, stack []byte)
+
+	// lastEvent and lastPayload describe the callback being handled, for
+	// crash reports
+	lastEvent   string
+	lastPayload interface{}
+
+	// conn and joinRef are the channel the session is joined on. A parked
+	// session is moved onto a new one by reattach, so they are guarded by
+	// the manager lock once the session is registered.
+	conn    *socket.Conn
+	joinRef string
+
+	// parkTimer terminates the session once the reconnect grace period
+	// runs out while it is parked
+	parkTimer *time.Timer
+
+	// mailbox is unbounded so that callbacks running on the session loop
+	// can enqueue further work without deadlocking
+	mu      sync.Mutex
+	mailbox []func()
+	wake    chan struct{}
+}
+
+// channelKey identifies a joined channel on a connection
+type channelKey struct {
+	conn  string
+	topic string
+}
+
+// newSession creates a session for a join on conn. Its context carries the
+// values of ctx but outlives the connection, so a session parked for
+// ReconnectRestore keeps running until it is terminated.
+func newSession(ctx context.Context, m *Manager, conn *socket.Conn, topic, joinRef string) *session {
+	base, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	return &session{
+		id:      conn.ID() + ":" + topic + ":" + joinRef,
+		joinRef: joinRef,
+		manager: m,
+		conn:    conn,
+		topic:   topic,
+		base:    base,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+func (s *session) key() channelKey {
+	return channelKey{conn: s.conn.ID(), topic: s.topic}
+}
+
+// push sends msg to the client on the channel the session is joined on
+func (s *session) push(msg *protocol.Message) {
+	s.manager.mu.RLock()
+	conn, joinRef := s.conn, s.joinRef
+	s.manager.mu.RUnlock()
+
+	msg.JoinRef = &joinRef
+	conn.Send(msg)
+}
+
+// run processes mailbox entries one at a time until the session stops
+func (s *session) run() {
+	for {
+		select {
+		case <-s.wake:
+		case <-s.done:
+			return
+		}
+
+		s.mu.Lock()
+		batch := s.mailbox
+		s.mailbox = nil
+		s.mu.Unlock()
+
+		for _, fn := range batch {
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+			s.invoke(fn)
+		}
+	}
+}
+
+// invoke runs fn, recovering any panic so a crashing LiveView cannot take
+// down the server
+func (s *session) invoke(fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			stack := debug.Stack()
+			if s.onPanic == nil {
+				s.stop()
+				return
+			}
+			s.onPanic(r, stack)
+		}
+	}()
+	fn()
+}
+
+// send enqueues fn on the session mailbox. It never blocks and reports false
+// if the session has already stopped.
+func (s *session) send(fn func()) bool {
+	s.mu.Lock()
+	select {
+	case <-s.done:
+		s.mu.Unlock()
+		return false
+	default:
+	}
+	s.mailbox = append(s.mailbox, fn)
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// stop terminates the session loop and cancels its context
+func (s *session) stop() {
+	s.once.Do(func() {
+		s.cancel()
+		close(s.done)
+	})
+}
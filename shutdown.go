@@ -0,0 +1,51 @@
+package liveview
+
+import (
+	"context"
+)
+
+// Shutdown stops the manager gracefully. New joins are rejected, every
+// session, including parked ones, is snapshotted when ReconnectRestore and
+// a StateStore are configured and then terminated with TerminateShutdown.
+// Finally the socket server closes each connection with a shutdown close
+// frame once its queued messages are written, which tells clients to
+// reconnect after a jittered delay. Shutdown returns ctx.Err() if ctx is
+// done before all of that has finished.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	m.closing = true
+	sessions := make([]*session, 0, len(m.sessions))
+	for _, sess := range m.sessions {
+		sessions = append(sessions, sess)
+	}
+	m.mu.Unlock()
+
+	for _, sess := range sessions {
+		sess.send(func() {
+			if sess.token != "" && sess.ctx != nil && m.restoring() {
+				m.saveSnapshot(sess)
+			}
+			m.terminate(sess, TerminateShutdown)
+		})
+	}
+
+	// If ctx runs out first, the socket server closes what is left
+	// immediately
+wait:
+	for _, sess := range sessions {
+		select {
+		case <-sess.done:
+		case <-ctx.Done():
+			break wait
+		}
+	}
+
+	return m.server.Shutdown(ctx)
+}
+
+// shuttingDown reports whether Shutdown has been called
+func (m *Manager) shuttingDown() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.closing
+}
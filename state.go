@@ -0,0 +1,268 @@
+package liveview
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrStateNotFound is returned by StateStore.Load when no unexpired state
+// is stored under the key
+var ErrStateNotFound = errors.New("state not found")
+
+// Snapshotter is implemented by LiveViews whose state can be saved and
+// rehydrated on another node or after a restart. With ReconnectRestore and
+// a StateStore configured, a snapshot is taken when the session is parked,
+// and a rejoin on a node that does not hold the session calls Mount and
+// then Restore with it.
+type Snapshotter interface {
+	// Snapshot returns the serialized state of the LiveView
+	Snapshot() ([]byte, error)
+
+	// Restore replaces the state of the LiveView with a snapshot. It is
+	// called after Mount, so subscriptions and timers are set up as usual.
+	Restore(data []byte) error
+}
+
+// StateStore is the interface for storing LiveView snapshots
+type StateStore interface {
+	// Save stores data under key until ttl has passed
+	Save(key string, data []byte, ttl time.Duration) error
+
+	// Load returns the data stored under key, or ErrStateNotFound
+	Load(key string) ([]byte, error)
+
+	// Delete removes the data stored under key
+	Delete(key string) error
+}
+
+// SetStateStore sets the store used to snapshot sessions for
+// ReconnectRestore
+func (m *Manager) SetStateStore(store StateStore) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stateStore = store
+}
+
+// stateKey returns the StateStore key for the session with token. The
+// token itself is not stored.
+func stateKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// saveSnapshot runs on the session loop and stores a snapshot of sess
+func (m *Manager) saveSnapshot(sess *session) {
+	m.mu.RLock()
+	store, grace := m.stateStore, m.reconnectGrace
+	m.mu.RUnlock()
+
+	s, ok := sess.lv.(Snapshotter)
+	if store == nil || !ok {
+		return
+	}
+	data, err := s.Snapshot()
+	if err != nil {
+		log.Printf("Failed to snapshot session %s: %v", sess.id, err)
+		return
+	}
+	if err := store.Save(stateKey(sess.token), data, grace); err != nil {
+		log.Printf("Failed to save snapshot of session %s: %v", sess.id, err)
+	}
+}
+
+// loadSnapshot takes the snapshot stored for token out of the store
+func (m *Manager) loadSnapshot(token string) ([]byte, bool) {
+	m.mu.RLock()
+	store := m.stateStore
+	m.mu.RUnlock()
+
+	if store == nil || token == "" {
+		return nil, false
+	}
+	key := stateKey(token)
+	data, err := store.Load(key)
+	if err != nil {
+		if !errors.Is(err, ErrStateNotFound) {
+			log.Printf("Failed to load snapshot: %v", err)
+		}
+		return nil, false
+	}
+	if err := store.Delete(key); err != nil {
+		log.Printf("Failed to delete snapshot: %v", err)
+	}
+	return data, true
+}
+
+// deleteSnapshot removes the snapshot stored for token, if any
+func (m *Manager) deleteSnapshot(token string) {
+	m.mu.RLock()
+	store := m.stateStore
+	m.mu.RUnlock()
+
+	if store == nil {
+		return
+	}
+	if err := store.Delete(stateKey(token)); err != nil {
+		log.Printf("Failed to delete snapshot: %v", err)
+	}
+}
+
+// MemoryStateStore is an in-memory StateStore for single-node deployments
+// and tests
+type MemoryStateStore struct {
+	entries map[string]memoryState
+	mu      sync.Mutex
+}
+
+type memoryState struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+// NewMemoryStateStore creates a new in-memory state store
+func NewMemoryStateStore() *MemoryStateStore {
+	return &MemoryStateStore{
+		entries: make(map[string]memoryState),
+	}
+}
+
+// Save implements StateStore.Save
+func (s *MemoryStateStore) Save(key string, data []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = memoryState{
+		data:      append([]byte(nil), data...),
+		expiresAt: time.Now().Add(ttl),
+	}
+	return nil
+}
+
+// Load implements StateStore.Load
+func (s *MemoryStateStore) Load(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(s.entries, key)
+		return nil, ErrStateNotFound
+	}
+	return append([]byte(nil), entry.data...), nil
+}
+
+// Delete implements StateStore.Delete
+func (s *MemoryStateStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+// FileStateStore is a StateStore keeping one file per key in a directory,
+// e.g. on a volume shared by several nodes
+type FileStateStore struct {
+	dir string
+}
+
+type fileState struct {
+	Data      []byte    `json:"data"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewFileStateStore creates a state store in dir, creating the directory
+// if needed
+func NewFileStateStore(dir string) (*FileStateStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create state dir: %w", err)
+	}
+	return &FileStateStore{dir: dir}, nil
+}
+
+// Save implements StateStore.Save. The file is replaced atomically so
+// readers never see a partial write.
+func (s *FileStateStore) Save(key string, data []byte, ttl time.Duration) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(fileState{
+		Data:      data,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load implements StateStore.Load
+func (s *FileStateStore) Load(key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrStateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state fileState
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, fmt.Errorf("decode state %s: %w", key, err)
+	}
+	if time.Now().After(state.ExpiresAt) {
+		os.Remove(path)
+		return nil, ErrStateNotFound
+	}
+	return state.Data, nil
+}
+
+// Delete implements StateStore.Delete
+func (s *FileStateStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// path returns the file for key, rejecting keys that would escape dir
+func (s *FileStateStore) path(key string) (string, error) {
+	if key == "" || key != filepath.Base(key) || key[0] == '.' {
+		return "", fmt.Errorf("invalid state key %q", key)
+	}
+	return filepath.Join(s.dir, key), nil
+}
@@ -0,0 +1,52 @@
+package liveview
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"runtime/debug"
+
+	"github.com/fu2hito/go-liveview/internal/render"
+)
+
+// staticRender mounts the LiveView registered for topic without a socket
+// and returns its rendered HTML. It is used for the initial HTTP response,
+// before the client connects.
+func (m *Manager) staticRender(ctx context.Context, topic string, u *url.URL, s Session) (html string, err error) {
+	m.mu.RLock()
+	factory, ok := m.liveViews[topic]
+	m.mu.RUnlock()
+
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("static render panicked: %v\n%s", r, debug.Stack())
+		}
+	}()
+
+	lv := factory()
+	adapter := &socketAdapter{}
+	lvCtx := NewContext(ctx, adapter, "")
+	adapter.ctx = lvCtx
+	lvCtx.signed = s
+	lvCtx.flash = s.flash
+	if m.broadcaster != nil {
+		lvCtx.SetBroadcaster(m.broadcaster)
+	}
+
+	params := m.urlParams(topic, u)
+	if err := lv.Mount(lvCtx, params); err != nil {
+		return "", err
+	}
+	if err := lv.HandleParams(lvCtx, params); err != nil {
+		return "", err
+	}
+
+	// Strip the dynamic markers so the page matches what the client
+	// builds from the join reply
+	r := render.ParseTemplOutput(renderComponent(lv.Render(lvCtx)))
+	return render.BuildHTML(r.Static, r.Dynamic), nil
+}
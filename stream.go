@@ -0,0 +1,150 @@
+package liveview
+
+import (
+	"log"
+
+	"github.com/fu2hito/go-liveview/internal/render"
+)
+
+// StreamEntry is an item to be rendered into a stream. The element
+// rendered for it must have ID as its id attribute.
+type StreamEntry struct {
+	ID   string
+	Item interface{}
+}
+
+// stream holds the key function of a stream and its operations since the
+// last render. The items themselves are not kept once rendered.
+type stream struct {
+	key     func(item interface{}) string
+	entries []StreamEntry
+	ops     render.StreamOps
+}
+
+// Stream configures the stream name with key, which returns a unique key
+// for an item, and appends items to it. Render the stream's
+// StreamEntries in a stream part (<!--$0@:name-->), one element per entry
+// with the entry's ID as its id. Each render sends only the pending
+// inserts and deletes, and the client keeps the rows.
+func (c *Context) Stream(name string, items []interface{}, key func(item interface{}) string) {
+	if c.streams == nil {
+		c.streams = make(map[string]*stream)
+	}
+	s, ok := c.streams[name]
+	if !ok {
+		s = &stream{ops: render.StreamOps{Name: name}}
+		c.streams[name] = s
+	}
+	s.key = key
+
+	for _, item := range items {
+		c.StreamInsert(name, item, -1)
+	}
+	c.Changed[name] = true
+}
+
+// StreamInsert inserts item into the stream name at index at, or at the
+// end when at is negative. An item whose key is already in the stream is
+// updated in place.
+func (c *Context) StreamInsert(name string, item interface{}, at int) {
+	s, ok := c.streams[name]
+	if !ok {
+		log.Printf("Stream %s is not configured, dropping insert", name)
+		return
+	}
+	id := streamID(name, s.key(item))
+
+	s.entries = append(s.entries, StreamEntry{ID: id, Item: item})
+	s.ops.Inserts = append(s.ops.Inserts, render.StreamInsert{ID: id, At: at})
+	c.Changed[name] = true
+}
+
+// StreamDelete removes the item with key from the stream name
+func (c *Context) StreamDelete(name string, key string) {
+	s, ok := c.streams[name]
+	if !ok {
+		log.Printf("Stream %s is not configured, dropping delete", name)
+		return
+	}
+	id := streamID(name, key)
+
+	// An item inserted since the last render is not sent at all
+	entries := s.entries[:0]
+	for _, e := range s.entries {
+		if e.ID != id {
+			entries = append(entries, e)
+		}
+	}
+	s.entries = entries
+	inserts := s.ops.Inserts[:0]
+	for _, ins := range s.ops.Inserts {
+		if ins.ID != id {
+			inserts = append(inserts, ins)
+		}
+	}
+	s.ops.Inserts = inserts
+
+	s.ops.Deletes = append(s.ops.Deletes, id)
+	c.Changed[name] = true
+}
+
+// StreamReset removes all items from the stream name, including the ones
+// the client already has. Items inserted afterwards are kept.
+func (c *Context) StreamReset(name string) {
+	s, ok := c.streams[name]
+	if !ok {
+		log.Printf("Stream %s is not configured, dropping reset", name)
+		return
+	}
+	s.entries = nil
+	s.ops = render.StreamOps{Name: name, Reset: true}
+	c.Changed[name] = true
+}
+
+// StreamEntries returns the items inserted into the stream name since the
+// last render
+func (c *Context) StreamEntries(name string) []StreamEntry {
+	if s, ok := c.streams[name]; ok {
+		return s.entries
+	}
+	return nil
+}
+
+// streamID returns the DOM id of the item with key in the stream name
+func streamID(name, key string) string {
+	return name + "-" + key
+}
+
+// withStreams returns a copy of dynamic, the parts of r to send, with each
+// stream part replaced by the stream's pending operations. A full render
+// sends every stream part so the client keeps the rows it has; a diff
+// only sends streams with operations.
+func (c *Context) withStreams(r *render.Rendered, dynamic []interface{}, full bool) []interface{} {
+	out := append([]interface{}(nil), dynamic...)
+	for i, name := range r.Stream {
+		if name == "" || i >= len(out) {
+			continue
+		}
+		ops := render.StreamOps{Name: name}
+		if s, ok := c.streams[name]; ok {
+			ops = s.ops
+		}
+		if !full && ops.Empty() {
+			out[i] = nil
+			continue
+		}
+		out[i] = &render.Patch{
+			Dynamic: []interface{}{r.Dynamic[i]},
+			Stream:  &ops,
+		}
+	}
+	return out
+}
+
+// resetStreams drops the operations of all streams after a render
+func (c *Context) resetStreams() {
+	for name, s := range c.streams {
+		s.entries = nil
+		s.ops = render.StreamOps{Name: name}
+	}
+}
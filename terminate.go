@@ -0,0 +1,39 @@
+package liveview
+
+// Terminator is implemented by LiveViews that need to release resources
+// when their session ends
+type Terminator interface {
+	// Terminate is called once, on the session loop. The context is
+	// cancelled as soon as Terminate returns.
+	Terminate(ctx *Context, reason TerminateReason)
+}
+
+// TerminateReason says why a LiveView session ended
+type TerminateReason int
+
+const (
+	// TerminateLeave means the client left the channel with phx_leave
+	TerminateLeave TerminateReason = iota
+	// TerminateDisconnect means the WebSocket connection closed
+	TerminateDisconnect
+	// TerminateCrash means a LiveView callback panicked or failed
+	TerminateCrash
+	// TerminateShutdown means the server is shutting down
+	TerminateShutdown
+)
+
+// String returns the reason name
+func (r TerminateReason) String() string {
+	switch r {
+	case TerminateLeave:
+		return "leave"
+	case TerminateDisconnect:
+		return "disconnect"
+	case TerminateCrash:
+		return "crash"
+	case TerminateShutdown:
+		return "shutdown"
+	default:
+		return "unknown"
+	}
+}
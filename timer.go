@@ -0,0 +1,50 @@
+package liveview
+
+import (
+	"context"
+	"time"
+)
+
+// SendAfter delivers msg to the LiveView's HandleInfo after d has elapsed.
+// The returned function cancels the timer; it is also cancelled
+// automatically when the session ends.
+func (c *Context) SendAfter(d time.Duration, msg interface{}) context.CancelFunc {
+	ctx, cancel := context.WithCancel(c)
+	timer := time.AfterFunc(d, func() {
+		if ctx.Err() == nil {
+			c.Send(msg)
+		}
+		cancel()
+	})
+	context.AfterFunc(ctx, func() {
+		timer.Stop()
+	})
+
+	return cancel
+}
+
+// Every delivers msg to the LiveView's HandleInfo once per interval until
+// the returned function is called or the session ends. A non-positive
+// interval delivers nothing and returns a no-op function.
+func (c *Context) Every(interval time.Duration, msg interface{}) context.CancelFunc {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(c)
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.Send(msg)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return cancel
+}
@@ -0,0 +1,95 @@
+package liveview
+
+import (
+	"errors"
+	"fmt"
+
+	lvsession "github.com/fu2hito/go-liveview/internal/session"
+)
+
+// ErrInvalidSession is returned for session tokens that are malformed,
+// tampered with, expired or minted for another LiveView
+var ErrInvalidSession = errors.New("invalid session")
+
+// Session is the server-side data a LiveView is mounted with. It is signed
+// into the page on the initial HTTP request and verified again when the
+// client joins, so Mount sees the same values in both passes.
+type Session struct {
+	UserID string
+	Data   map[string]interface{}
+
+	// flash is carried over to the LiveView the session is signed for
+	flash map[string]string
+}
+
+// Session returns the verified session the LiveView was mounted with. It
+// is empty when the client joined without a token.
+func (c *Context) Session() Session {
+	return c.signed
+}
+
+// setSessionSecret sets the secret session tokens are signed with
+func (m *Manager) setSessionSecret(secret string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.signer = lvsession.NewManager(secret)
+}
+
+// hasSessionSecret reports whether a session secret has been set
+func (m *Manager) hasSessionSecret() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.signer != nil
+}
+
+// signSession returns a token binding s to the LiveView on topic
+func (m *Manager) signSession(topic string, s Session) (string, error) {
+	m.mu.RLock()
+	signer := m.signer
+	m.mu.RUnlock()
+
+	if signer == nil {
+		return "", fmt.Errorf("no session secret configured")
+	}
+	data := map[string]interface{}{
+		"view": topic,
+		"data": s.Data,
+	}
+	if len(s.flash) > 0 {
+		data["flash"] = s.flash
+	}
+	token, err := signer.Create(s.UserID, data)
+	if err != nil {
+		return "", err
+	}
+	return signer.Encode(token)
+}
+
+// verifySession validates a token sent on join for the LiveView on topic.
+// Once a session secret is configured every join needs a token, so a
+// client cannot skip the checks of HandlerOptions.Session by leaving it
+// out. Without a secret only an empty token is accepted.
+func (m *Manager) verifySession(token, topic string) (Session, error) {
+	m.mu.RLock()
+	signer := m.signer
+	m.mu.RUnlock()
+
+	switch {
+	case signer == nil && token == "":
+		return Session{}, nil
+	case signer == nil:
+		return Session{}, fmt.Errorf("%w: no session secret configured", ErrInvalidSession)
+	case token == "":
+		return Session{}, fmt.Errorf("%w: missing session token", ErrInvalidSession)
+	}
+	s, err := signer.Validate(token)
+	if err != nil {
+		return Session{}, fmt.Errorf("%w: %v", ErrInvalidSession, err)
+	}
+	if view, _ := s.Data["view"].(string); view != topic {
+		return Session{}, fmt.Errorf("%w: token is for %q", ErrInvalidSession, s.Data["view"])
+	}
+
+	data, _ := s.Data["data"].(map[string]interface{})
+	return Session{UserID: s.UserID, Data: data, flash: decodeFlash(s.Data["flash"])}, nil
+}